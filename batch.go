@@ -0,0 +1,636 @@
+package xsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// BatchPolicy 批量插入的分批策略
+// 行数或绑定参数超过限制时拆分为多条插入语句依次执行
+type BatchPolicy struct {
+	// 每条语句的最大行数，用于避免超过 mysql 的 max_allowed_packet，默认: 0 不限制
+	Rows int
+
+	// 每条语句的最大绑定参数数量，默认: 0 使用方言的限制，如 mysql 65535、sql server 2100，超过方言的限制时使用方言的限制
+	MaxParams int
+
+	// 拆分为多条语句时默认在同一个事务中执行，任意一条失败则全部回滚，已在事务 (Tx) 中时不再开启
+	// 为 true 时各语句单独提交，失败时之前的语句不会回滚
+	NoTransaction bool
+}
+
+// batchLimit 方言对单条语句的限制，0 表示不限制
+type batchLimit interface {
+	batchLimit() (rows int, params int)
+}
+
+func (MysqlDialect) batchLimit() (int, int) {
+	return 0, 65535
+}
+
+// batchLimit oracle 的 INSERT ALL 行数较多时解析较慢
+func (OracleDialect) batchLimit() (int, int) {
+	return 1000, 65535
+}
+
+// batchLimit sql server 的 VALUES 最多 1000 行，参数最多 2100 个
+func (MssqlDialect) batchLimit() (int, int) {
+	return 1000, 2100
+}
+
+func (PostgresDialect) batchLimit() (int, int) {
+	return 0, 65535
+}
+
+// batchLimit sqlite 3.32 及以上版本
+func (SqliteDialect) batchLimit() (int, int) {
+	return 0, 32766
+}
+
+// batchInserter 不支持多行 VALUES 的方言生成多行插入语句
+type batchInserter interface {
+	batchInsert(insert InsertSQL) string
+}
+
+/*
+@Description: oracle 使用 INSERT ALL 插入多行
+INSERT ALL INTO T (A, B) VALUES (:1, :2) INTO T (A, B) VALUES (:3, :4) SELECT 1 FROM DUAL
+同一条语句中的序列 NEXTVAL 只取值一次，自增主键需使用 IDENTITY 列或触发器
+@param insert
+@return string
+*/
+func (OracleDialect) batchInsert(insert InsertSQL) string {
+	var b strings.Builder
+	b.WriteString("INSERT ALL")
+	columns := strings.Join(insert.Columns, ", ")
+	for _, vars := range insert.Values {
+		b.WriteString(fmt.Sprintf(" INTO %s (%s) VALUES (%s)", insert.Table, columns, strings.Join(vars, ", ")))
+	}
+	b.WriteString(" SELECT 1 FROM DUAL")
+	return b.String()
+}
+
+func (t *Options) batch() *BatchPolicy {
+	if t.Batch == nil {
+		return &BatchPolicy{}
+	}
+	return t.Batch
+}
+
+/*
+@Description: 每条语句的行数
+@receiver t
+@param dialect
+@param columns 每行绑定的参数数量
+@return int 0 表示不拆分
+*/
+func (t *BatchPolicy) size(dialect Dialect, columns int) int {
+	rows, params := t.Rows, t.MaxParams
+	if limit, ok := dialect.(batchLimit); ok {
+		limitRows, limitParams := limit.batchLimit()
+		if limitRows > 0 && (rows == 0 || limitRows < rows) {
+			rows = limitRows
+		}
+		if params == 0 || (limitParams > 0 && params > limitParams) {
+			params = limitParams
+		}
+	}
+	if params > 0 && columns > 0 {
+		byParams := params / columns
+		if byParams < 1 {
+			byParams = 1
+		}
+		if rows == 0 || byParams < rows {
+			rows = byParams
+		}
+	}
+	return rows
+}
+
+// batchStatement 一条多行插入语句：插入的字段及对应的行
+type batchStatement struct {
+	columns []*field
+	// 行在数组/切片中的位置
+	rows []int
+}
+
+/*
+@Description: 按插入的字段分组，与 Insert 一致忽略 omitempty、autoincr 的空值，每组再按分批策略拆分为多条语句
+只有相邻的行插入的字段不同时才开始新的一组，保持数组/切片中的插入顺序
+@receiver t
+@param rows 结构体数组/切片
+@param opts
+@return []batchStatement
+*/
+func (t *model) batchStatements(rows reflect.Value, opts *Options) []batchStatement {
+	groups := make([]*batchStatement, 0, 1)
+	var last string
+	key := make([]byte, len(t.fields))
+	for r := 0; r < rows.Len(); r++ {
+		row := rows.Index(r)
+		for i, f := range t.fields {
+			key[i] = '0'
+			if f.insertable() && !f.insertSkip(row.Field(f.index[0])) {
+				key[i] = '1'
+			}
+		}
+		if len(groups) == 0 || string(key) != last {
+			g := &batchStatement{}
+			for i, f := range t.fields {
+				if key[i] == '1' {
+					g.columns = append(g.columns, f)
+				}
+			}
+			last = string(key)
+			groups = append(groups, g)
+		}
+		g := groups[len(groups)-1]
+		g.rows = append(g.rows, r)
+	}
+
+	statements := make([]batchStatement, 0, len(groups))
+	for _, g := range groups {
+		size := opts.batch().size(opts.dialect(), len(g.columns))
+		if size == 0 {
+			size = len(g.rows)
+		}
+		for i := 0; i < len(g.rows); i += size {
+			end := i + size
+			if end > len(g.rows) {
+				end = len(g.rows)
+			}
+			statements = append(statements, batchStatement{
+				columns: g.columns,
+				rows:    g.rows[i:end],
+			})
+		}
+	}
+	return statements
+}
+
+/*
+@Description: 依次执行多行插入语句，返回的 sql.Result 为各语句影响行数之和
+多条语句时每条单独输出日志，Log.Chunk 为语句的序号，默认在同一个事务中执行
+@receiver t
+@param ctx
+@param rows 结构体数组/切片
+@param m
+@param statements
+@param build 生成语句，为 nil 时使用方言的插入语句
+@param opts
+@return sql.Result
+@return error
+*/
+func (t *executor) batchInsert(ctx context.Context, rows reflect.Value, m *model, statements []batchStatement, build func(insert InsertSQL, columns []*field) string, opts *Options) (sql.Result, error) {
+	if len(statements) == 1 {
+		return t.execBatch(ctx, rows, m, statements[0], build, 0, opts)
+	}
+
+	var res QueryRes
+	err := t.batchTx(ctx, !opts.batch().NoTransaction, opts, func(exec *executor) error {
+		for i, stmt := range statements {
+			r, err := exec.execBatch(ctx, rows, m, stmt, build, i+1, opts)
+			if err != nil {
+				return err
+			}
+			if i == 0 {
+				res.InsertId, _ = r.LastInsertId()
+			}
+			affected, _ := r.RowsAffected()
+			res.Affected += affected
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// batchTx begin 为 true 时在同一个事务中执行 fn，fn 返回错误时回滚，已在事务 (Tx) 中时直接执行
+func (t *executor) batchTx(ctx context.Context, begin bool, opts *Options, fn func(exec *executor) error) error {
+	db, ok := t.Executor.(*sql.DB)
+	if !begin || !ok {
+		return fn(t)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return opts.wrapError(err)
+	}
+	if err := fn(&executor{Executor: tx}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return opts.wrapError(tx.Commit())
+}
+
+// execBatch 执行一条多行插入语句，chunk 为语句的序号，只有一条语句时为 0
+func (t *executor) execBatch(ctx context.Context, rows reflect.Value, m *model, stmt batchStatement, build func(insert InsertSQL, columns []*field) string, chunk int, opts *Options) (sql.Result, error) {
+	insert, bindArgs := m.batchInsert(rows, stmt, opts)
+	var SQL string
+	if build != nil {
+		SQL = build(insert, stmt.columns)
+	} else if b, ok := opts.dialect().(batchInserter); ok && len(insert.Values) > 1 {
+		SQL = b.batchInsert(insert)
+	} else {
+		SQL = insert.String()
+	}
+
+	startTime := time.Now()
+	res, err := t.execContext(ctx, SQL, bindArgs, opts)
+	var rowsAffected int64
+	if res != nil {
+		rowsAffected, _ = res.RowsAffected()
+	}
+	l := &Log{
+		Time:         time.Now().Sub(startTime),
+		SQL:          SQL,
+		Bindings:     bindArgs,
+		RowsAffected: rowsAffected,
+		Error:        err,
+		Chunk:        chunk,
+	}
+	if opts.DebugFunc != nil {
+		opts.DebugFunc(l)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// batchRows 检查批量插入的数据，返回数组/切片及元素的解析结果
+func batchRows(array interface{}) (reflect.Value, *model, error) {
+	value := reflect.Indirect(reflect.ValueOf(array))
+	switch value.Kind() {
+	case reflect.Array, reflect.Slice:
+		break
+	default:
+		return value, nil, errors.New("sql: only for struct array/slice type")
+	}
+	if value.Len() == 0 {
+		return value, nil, errors.New("sql: array/slice length cannot be 0")
+	}
+	if value.Type().Elem().Kind() != reflect.Struct {
+		return value, nil, errors.New("sql: only for struct array/slice type")
+	}
+	m, err := modelOf(value.Type().Elem())
+	if err != nil {
+		return value, nil, err
+	}
+	// 拆分时需要对数组切片
+	if !value.CanAddr() {
+		addr := reflect.New(value.Type()).Elem()
+		addr.Set(value)
+		value = addr
+	}
+	return value, m, nil
+}
+
+/*
+@Description: 生成多行插入语句，字段值的处理与 Insert 一致
+@receiver t
+@param rows 结构体数组/切片
+@param stmt 插入的字段及行
+@param opts
+@return InsertSQL
+@return []interface{} 绑定参数
+*/
+func (t *model) batchInsert(rows reflect.Value, stmt batchStatement, opts *Options) (InsertSQL, []interface{}) {
+	insertKey := "INSERT INTO"
+	if opts.InsertKey != "" {
+		insertKey = opts.InsertKey
+	}
+	dialect := opts.dialect()
+	ph := newPlaceholders(dialect)
+	timeLayout := opts.timeLayout()
+
+	fields := make([]string, 0, len(stmt.columns))
+	for _, f := range stmt.columns {
+		fields = append(fields, dialect.Quote(f.column))
+	}
+
+	valueSql := make([][]string, 0, len(stmt.rows))
+	bindArgs := make([]interface{}, 0, len(stmt.rows)*len(stmt.columns))
+	for _, r := range stmt.rows {
+		subValue := rows.Index(r)
+		vars := make([]string, 0, len(stmt.columns))
+		for _, f := range stmt.columns {
+			fieldValue := subValue.Field(f.index[0])
+			if f.insertDefault(fieldValue) {
+				vars = append(vars, f.def)
+				continue
+			}
+			v, bindVal := dialect.Bind(ph.next(), f.basic(fieldValue), timeLayout)
+			vars = append(vars, f.placeholder(v))
+			bindArgs = append(bindArgs, bindVal)
+		}
+		valueSql = append(valueSql, vars)
+	}
+
+	insert := InsertSQL{
+		Key:     insertKey,
+		Table:   t.tableName(rows.Index(0).Interface()),
+		Columns: fields,
+		Values:  valueSql,
+	}
+	return insert, bindArgs
+}
+
+// preparedUpdate BatchUpdate 逐行执行预处理语句的方言
+type preparedUpdate interface {
+	preparedUpdate()
+}
+
+// preparedUpdate postgresql 无法推断 CASE 中绑定参数的类型
+func (PostgresDialect) preparedUpdate() {}
+
+/*
+@Description: 根据主键批量更新
+默认生成 UPDATE ... SET c = CASE WHEN pk = ? THEN ? ... ELSE c END WHERE pk IN (...)，按分批策略拆分为多条语句
+postgresql 在事务中逐行执行预处理语句
+@receiver t
+@param ctx
+@param array 结构体数组/切片
+@param columns 更新的列名，为空时更新全部可写入的字段并忽略 omitempty 的空值，指定时空值同样更新
+@param opts
+@return int64 影响的行数
+@return error
+*/
+func (t *executor) BatchUpdate(ctx context.Context, array interface{}, columns []string, opts *Options) (int64, error) {
+	rows, m, err := batchRows(array)
+	if err != nil {
+		return 0, err
+	}
+	primary := m.primary(rows.Index(0).Interface())
+	if len(primary) == 0 {
+		return 0, errPrimaryUndefined
+	}
+	fields, err := m.updateFields(primary, columns)
+	if err != nil {
+		return 0, err
+	}
+	force := len(columns) > 0
+	for r := 0; r < rows.Len(); r++ {
+		for _, f := range primary {
+			v := rows.Index(r).Field(f.index[0])
+			if v.IsZero() || f.isEmpty(v) {
+				return 0, ErrPrimaryKeyZero
+			}
+		}
+	}
+
+	if _, ok := opts.dialect().(preparedUpdate); ok {
+		return t.batchUpdatePrepared(ctx, rows, m, primary, fields, force, opts)
+	}
+
+	size := opts.batch().size(opts.dialect(), len(fields)*(len(primary)+1)+len(primary))
+	if size == 0 {
+		size = rows.Len()
+	}
+	chunks := (rows.Len() + size - 1) / size
+	var affected int64
+	err = t.batchTx(ctx, chunks > 1 && !opts.batch().NoTransaction, opts, func(exec *executor) error {
+		for i := 0; i < rows.Len(); i += size {
+			end := i + size
+			if end > rows.Len() {
+				end = rows.Len()
+			}
+			chunk := 0
+			if chunks > 1 {
+				chunk = i/size + 1
+			}
+			SQL, bindArgs := m.batchUpdate(rows.Slice(i, end), primary, fields, force, opts)
+			if SQL == "" {
+				continue
+			}
+			res, err := exec.execUpdate(ctx, SQL, bindArgs, chunk, opts)
+			if err != nil {
+				return err
+			}
+			n, _ := res.RowsAffected()
+			affected += n
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return affected, nil
+}
+
+// batchUpdatePrepared 在事务中逐行执行预处理语句，更新的字段不同的行使用不同的语句
+func (t *executor) batchUpdatePrepared(ctx context.Context, rows reflect.Value, m *model, primary []*field, fields []*field, force bool, opts *Options) (int64, error) {
+	var affected int64
+	err := t.batchTx(ctx, true, opts, func(exec *executor) error {
+		stmts := make(map[string]*sql.Stmt)
+		defer func() {
+			for _, stmt := range stmts {
+				_ = stmt.Close()
+			}
+		}()
+		preparer, _ := exec.Executor.(interface {
+			PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+		})
+
+		chunk := 0
+		for r := 0; r < rows.Len(); r++ {
+			SQL, bindArgs := m.batchUpdate(rows.Slice(r, r+1), primary, fields, force, opts)
+			if SQL == "" {
+				continue
+			}
+			// 只有一行时与不拆分的语句一致，Log.Chunk 为 0
+			if rows.Len() > 1 {
+				chunk++
+			}
+			var res sql.Result
+			var err error
+			startTime := time.Now()
+			if preparer == nil {
+				res, err = exec.execContext(ctx, SQL, bindArgs, opts)
+			} else {
+				stmt, ok := stmts[SQL]
+				if !ok {
+					if stmt, err = preparer.PrepareContext(ctx, SQL); err == nil {
+						stmts[SQL] = stmt
+					}
+				}
+				if err == nil {
+					res, err = stmt.ExecContext(ctx, bindArgs...)
+				}
+				err = opts.wrapError(err)
+			}
+			var rowsAffected int64
+			if res != nil {
+				rowsAffected, _ = res.RowsAffected()
+			}
+			if opts.DebugFunc != nil {
+				opts.DebugFunc(&Log{
+					Time:         time.Now().Sub(startTime),
+					SQL:          SQL,
+					Bindings:     bindArgs,
+					RowsAffected: rowsAffected,
+					Error:        err,
+					Chunk:        chunk,
+				})
+			}
+			if err != nil {
+				return err
+			}
+			affected += rowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return affected, nil
+}
+
+// execUpdate 执行一条批量更新语句，chunk 为拆分后的序号，未拆分时为 0
+func (t *executor) execUpdate(ctx context.Context, SQL string, bindArgs []interface{}, chunk int, opts *Options) (sql.Result, error) {
+	startTime := time.Now()
+	res, err := t.execContext(ctx, SQL, bindArgs, opts)
+	var rowsAffected int64
+	if res != nil {
+		rowsAffected, _ = res.RowsAffected()
+	}
+	l := &Log{
+		Time:         time.Now().Sub(startTime),
+		SQL:          SQL,
+		Bindings:     bindArgs,
+		RowsAffected: rowsAffected,
+		Error:        err,
+		Chunk:        chunk,
+	}
+	if opts.DebugFunc != nil {
+		opts.DebugFunc(l)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// updateFields 批量更新的字段，指定的列必须是可更新的非主键字段
+func (t *model) updateFields(primary []*field, columns []string) ([]*field, error) {
+	fields := make([]*field, 0, len(t.fields))
+	if len(columns) == 0 {
+		for _, f := range t.fields {
+			if f.updatable() && !f.isPrimary(primary) {
+				fields = append(fields, f)
+			}
+		}
+	}
+	for _, c := range columns {
+		f := t.field(c)
+		if f == nil || !f.updatable() || f.isPrimary(primary) {
+			return nil, fmt.Errorf("sql: column %s cannot be updated", c)
+		}
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("sql: no columns to update")
+	}
+	return fields, nil
+}
+
+/*
+@Description: 生成根据主键批量更新的语句，单行时为普通的更新语句
+@receiver t
+@param rows 结构体数组/切片
+@param primary
+@param fields 更新的字段
+@param force 为 false 时忽略 omitempty 的空值
+@param opts
+@return string 没有需要更新的值时为空
+@return []interface{} 绑定参数
+*/
+func (t *model) batchUpdate(rows reflect.Value, primary []*field, fields []*field, force bool, opts *Options) (string, []interface{}) {
+	dialect := opts.dialect()
+	ph := newPlaceholders(dialect)
+	timeLayout := opts.timeLayout()
+	bindArgs := make([]interface{}, 0)
+
+	bind := func(f *field, v reflect.Value) string {
+		p, bindVal := dialect.Bind(ph.next(), f.basic(v), timeLayout)
+		bindArgs = append(bindArgs, bindVal)
+		return f.placeholder(p)
+	}
+	// cond 主键条件
+	cond := func(row reflect.Value) string {
+		where := make([]string, 0, len(primary))
+		for _, f := range primary {
+			where = append(where, fmt.Sprintf("%s = %s", dialect.Quote(f.column), bind(f, row.Field(f.index[0]))))
+		}
+		return strings.Join(where, " AND ")
+	}
+	skip := func(f *field, v reflect.Value) bool {
+		return !force && f.omitempty && f.isEmpty(v)
+	}
+
+	set := make([]string, 0, len(fields))
+	if rows.Len() == 1 {
+		row := rows.Index(0)
+		for _, f := range fields {
+			v := row.Field(f.index[0])
+			if skip(f, v) {
+				continue
+			}
+			set = append(set, fmt.Sprintf("%s = %s", dialect.Quote(f.column), bind(f, v)))
+		}
+		if len(set) == 0 {
+			return "", nil
+		}
+		return fmt.Sprintf("UPDATE %s SET %s WHERE %s", t.tableName(row.Interface()), strings.Join(set, ", "), cond(row)), bindArgs
+	}
+
+	// 有需要更新的值的行
+	updated := make([]bool, rows.Len())
+	for _, f := range fields {
+		when := make([]string, 0, rows.Len())
+		for r := 0; r < rows.Len(); r++ {
+			row := rows.Index(r)
+			v := row.Field(f.index[0])
+			if skip(f, v) {
+				continue
+			}
+			updated[r] = true
+			c := cond(row)
+			when = append(when, fmt.Sprintf("WHEN %s THEN %s", c, bind(f, v)))
+		}
+		if len(when) == 0 {
+			continue
+		}
+		column := dialect.Quote(f.column)
+		set = append(set, fmt.Sprintf("%s = CASE %s ELSE %s END", column, strings.Join(when, " "), column))
+	}
+	if len(set) == 0 {
+		return "", nil
+	}
+
+	where := make([]string, 0, rows.Len())
+	for r := 0; r < rows.Len(); r++ {
+		if !updated[r] {
+			continue
+		}
+		row := rows.Index(r)
+		if len(primary) == 1 {
+			where = append(where, bind(primary[0], row.Field(primary[0].index[0])))
+		} else {
+			where = append(where, "("+cond(row)+")")
+		}
+	}
+	SQL := fmt.Sprintf("UPDATE %s SET %s WHERE ", t.tableName(rows.Index(0).Interface()), strings.Join(set, ", "))
+	if len(primary) == 1 {
+		SQL += fmt.Sprintf("%s IN (%s)", dialect.Quote(primary[0].column), strings.Join(where, ", "))
+	} else {
+		SQL += strings.Join(where, " OR ")
+	}
+	return SQL, bindArgs
+}
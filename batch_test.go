@@ -0,0 +1,287 @@
+package xsql
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatchPolicySize(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(21845, (&BatchPolicy{}).size(MysqlDialect{}, 3))
+	a.Equal(100, (&BatchPolicy{Rows: 100}).size(MysqlDialect{}, 3))
+	a.Equal(3, (&BatchPolicy{Rows: 100, MaxParams: 10}).size(MysqlDialect{}, 3))
+	a.Equal(1, (&BatchPolicy{MaxParams: 2}).size(MysqlDialect{}, 3))
+	// sql server 最多 1000 行、2100 个参数
+	a.Equal(1000, (&BatchPolicy{}).size(MssqlDialect{}, 2))
+	a.Equal(700, (&BatchPolicy{Rows: 5000}).size(MssqlDialect{}, 3))
+	// 超过方言的参数限制时使用方言的限制
+	a.Equal(700, (&BatchPolicy{MaxParams: 5000}).size(MssqlDialect{}, 3))
+	a.Equal(21845, (&BatchPolicy{MaxParams: 100000}).size(MysqlDialect{}, 3))
+}
+
+func TestBatchInsertChunk(t *testing.T) {
+	a := assert.New(t)
+
+	var logs []*Log
+	DB, rec := newFakeDB(Options{
+		Batch: &BatchPolicy{Rows: 2},
+		DebugFunc: func(l *Log) {
+			logs = append(logs, l)
+		},
+	})
+
+	tests := []TestModelComposite{
+		{TenantId: "t1", Code: "c1"},
+		{TenantId: "t1", Code: "c2"},
+		{TenantId: "t1", Code: "c3"},
+		{TenantId: "t1", Code: "c4"},
+		{TenantId: "t1", Code: "c5"},
+	}
+	res, err := DB.BatchInsert(tests)
+	a.Empty(err)
+	affected, _ := res.RowsAffected()
+	a.Equal(int64(3), affected)
+	// 拆分后默认在同一个事务中执行
+	a.Equal([]string{
+		"BEGIN",
+		"INSERT INTO composite (`tenant_id`, `code`, `name`) VALUES (?, ?, ?), (?, ?, ?)",
+		"INSERT INTO composite (`tenant_id`, `code`, `name`) VALUES (?, ?, ?), (?, ?, ?)",
+		"INSERT INTO composite (`tenant_id`, `code`, `name`) VALUES (?, ?, ?)",
+		"COMMIT",
+	}, rec.SQL())
+	a.Equal([]interface{}{"t1", "c5", ""}, rec.Stmts[3].Args)
+	a.Len(logs, 3)
+	for i, l := range logs {
+		a.Equal(i+1, l.Chunk)
+	}
+
+	// 不超过限制时不拆分，不开启事务
+	logs = logs[:0]
+	rec.Stmts = nil
+	_, err = DB.BatchInsert(tests[:2])
+	a.Empty(err)
+	a.Equal(0, logs[0].Chunk)
+	a.Len(rec.SQL(), 1)
+
+	// 数组同样可以拆分
+	_, err = DB.BatchInsert([3]TestModelComposite{})
+	a.Empty(err)
+	a.Equal("INSERT INTO composite (`tenant_id`, `code`, `name`) VALUES (?, ?, ?)", rec.Stmts[len(rec.Stmts)-2].SQL)
+}
+
+func TestBatchInsertTransaction(t *testing.T) {
+	a := assert.New(t)
+
+	DB, rec := newFakeDB(Options{
+		Dialect: PostgresDialect{},
+		Batch:   &BatchPolicy{MaxParams: 6},
+	})
+
+	tests := make([]TestModelComposite, 3)
+	_, err := DB.BatchInsert(&tests)
+	a.Empty(err)
+	// 每条语句的占位符重新编号
+	a.Equal([]string{
+		"BEGIN",
+		`INSERT INTO composite ("tenant_id", "code", "name") VALUES ($1, $2, $3), ($4, $5, $6)`,
+		`INSERT INTO composite ("tenant_id", "code", "name") VALUES ($1, $2, $3)`,
+		"COMMIT",
+	}, rec.SQL())
+
+	// 任意一条失败则回滚
+	rec.Stmts = nil
+	rec.Err = func(query string) error {
+		if strings.HasSuffix(query, "VALUES ($1, $2, $3)") {
+			return errors.New("insert failed")
+		}
+		return nil
+	}
+	_, err = DB.BatchInsert(&tests)
+	a.EqualError(err, "insert failed")
+	a.Equal("ROLLBACK", rec.Last().SQL)
+
+	// 已在事务中时不再开启
+	rec.Stmts = nil
+	rec.Err = nil
+	tx, err := DB.Begin()
+	a.Empty(err)
+	_, err = tx.BatchInsert(&tests)
+	a.Empty(err)
+	a.Empty(tx.Commit())
+	a.Equal([]string{"BEGIN", rec.SQL()[1], rec.SQL()[2], "COMMIT"}, rec.SQL())
+
+	// 不使用事务时各语句单独提交
+	DB, rec = newFakeDB(Options{
+		Dialect: PostgresDialect{},
+		Batch:   &BatchPolicy{MaxParams: 6, NoTransaction: true},
+	})
+	_, err = DB.BatchInsert(&tests)
+	a.Empty(err)
+	a.Len(rec.SQL(), 2)
+}
+
+func TestBatchInsertOracle(t *testing.T) {
+	a := assert.New(t)
+
+	DB, rec := newFakeDB(Oracle())
+	created := time.Date(2022, 4, 14, 23, 49, 48, 0, time.Local)
+
+	tests := []TestModelBase{{Created: created}, {Created: created}}
+	_, err := DB.BatchInsert(&tests)
+	a.Empty(err)
+	a.Equal(`INSERT ALL INTO TestModelBase ("created") VALUES (TO_TIMESTAMP(:1, 'SYYYY-MM-DD HH24:MI:SS:FF6')) INTO TestModelBase ("created") VALUES (TO_TIMESTAMP(:2, 'SYYYY-MM-DD HH24:MI:SS:FF6')) SELECT 1 FROM DUAL`, rec.Last().SQL)
+	a.Equal([]interface{}{"2022-04-14 23:49:48", "2022-04-14 23:49:48"}, rec.Last().Args)
+
+	// 单行使用普通的插入语句
+	_, err = DB.BatchInsert(tests[:1])
+	a.Empty(err)
+	a.Equal(`INSERT INTO TestModelBase ("created") VALUES (TO_TIMESTAMP(:1, 'SYYYY-MM-DD HH24:MI:SS:FF6'))`, rec.Last().SQL)
+}
+
+func TestBatchInsertOmitempty(t *testing.T) {
+	a := assert.New(t)
+
+	var logs []*Log
+	DB, rec := newFakeDB(Options{
+		DebugFunc: func(l *Log) {
+			logs = append(logs, l)
+		},
+	})
+
+	tests := []TestModel{
+		{Foo: "foo", Data: []byte("data")},
+		{Remark: sql.NullString{String: "remark", Valid: true}, Count: 1},
+		{Foo: "bar", Data: []byte("data"), Count: 2},
+		{Foo: "baz", Data: []byte("data"), Count: 3},
+	}
+	res, err := DB.BatchInsert(tests)
+	a.Empty(err)
+	affected, _ := res.RowsAffected()
+	a.Equal(int64(3), affected)
+
+	// 与 Insert 一致，相邻的行插入的字段不同时拆分为新的语句，保持插入顺序
+	a.Equal([]string{
+		"BEGIN",
+		"INSERT INTO model (`id`, `foo`, `data`, `count`) VALUES (?, ?, ?, ?)",
+		"INSERT INTO model (`id`, `remark`, `count`) VALUES (?, ?, ?)",
+		"INSERT INTO model (`id`, `foo`, `data`, `count`) VALUES (?, ?, ?, ?), (?, ?, ?, ?)",
+		"COMMIT",
+	}, rec.SQL())
+	a.Equal([]interface{}{XsqlInt(0), "foo", []byte("data"), uint32(0)}, rec.Stmts[1].Args)
+	a.Equal([]interface{}{XsqlInt(0), "remark", uint32(1)}, rec.Stmts[2].Args)
+	a.Equal([]interface{}{XsqlInt(0), "bar", []byte("data"), uint32(2), XsqlInt(0), "baz", []byte("data"), uint32(3)}, rec.Stmts[3].Args)
+	a.Len(logs, 3)
+	for i, l := range logs {
+		a.Equal(i+1, l.Chunk)
+	}
+
+	// 单条插入与批量插入的结果一致
+	for _, test := range tests {
+		rec.Stmts = nil
+		_, err = DB.Insert(&test)
+		a.Empty(err)
+		single := rec.Last()
+
+		rec.Stmts = nil
+		_, err = DB.BatchInsert([]TestModel{test})
+		a.Empty(err)
+		a.Equal(single, rec.Last())
+	}
+}
+
+func TestBatchUpdate(t *testing.T) {
+	a := assert.New(t)
+
+	var logs []*Log
+	DB, rec := newFakeDB(Options{
+		Batch: &BatchPolicy{Rows: 2},
+		DebugFunc: func(l *Log) {
+			logs = append(logs, l)
+		},
+	})
+
+	tests := []TestModelComposite{
+		{TenantId: "t1", Code: "c1", Name: "foo"},
+		{TenantId: "t1", Code: "c2", Name: "bar"},
+		{TenantId: "t2", Code: "c1"},
+	}
+	affected, err := DB.BatchUpdate(tests)
+	a.Empty(err)
+	a.Equal(int64(2), affected)
+	a.Equal([]string{
+		"BEGIN",
+		"UPDATE composite SET `name` = CASE WHEN `tenant_id` = ? AND `code` = ? THEN ? WHEN `tenant_id` = ? AND `code` = ? THEN ? ELSE `name` END WHERE (`tenant_id` = ? AND `code` = ?) OR (`tenant_id` = ? AND `code` = ?)",
+		"UPDATE composite SET `name` = ? WHERE `tenant_id` = ? AND `code` = ?",
+		"COMMIT",
+	}, rec.SQL())
+	a.Equal([]interface{}{"t1", "c1", "foo", "t1", "c2", "bar", "t1", "c1", "t1", "c2"}, rec.Stmts[1].Args)
+	a.Equal([]interface{}{"", "t2", "c1"}, rec.Stmts[2].Args)
+	a.Equal(1, logs[0].Chunk)
+	a.Equal(2, logs[1].Chunk)
+
+	// 未指定更新的列时忽略 omitempty 的空值
+	rec.Stmts = nil
+	models := []TestModelTag{
+		{Id: 1, Name: "foo", Amount: "1.50"},
+		{Id: 2, Name: "bar"},
+	}
+	_, err = DB.BatchUpdate(models)
+	a.Empty(err)
+	a.Equal("UPDATE tag SET `name` = CASE WHEN `id` = ? THEN ? WHEN `id` = ? THEN ? ELSE `name` END, `updated` = CASE WHEN `id` = ? THEN ? WHEN `id` = ? THEN ? ELSE `updated` END, `amount` = CASE WHEN `id` = ? THEN CAST(? AS DECIMAL(10,2)) ELSE `amount` END WHERE `id` IN (?, ?)", rec.Last().SQL)
+
+	_, err = DB.BatchUpdate(models, "amount")
+	a.Empty(err)
+	a.Equal("UPDATE tag SET `amount` = CASE WHEN `id` = ? THEN CAST(? AS DECIMAL(10,2)) WHEN `id` = ? THEN CAST(? AS DECIMAL(10,2)) ELSE `amount` END WHERE `id` IN (?, ?)", rec.Last().SQL)
+	a.Equal([]interface{}{int64(1), "1.50", int64(2), "", int64(1), int64(2)}, rec.Last().Args)
+
+	// 主键为零值、不可更新的列
+	count := len(rec.SQL())
+	_, err = DB.BatchUpdate([]TestModelTag{{Id: 1}, {Name: "foo"}})
+	a.ErrorIs(err, ErrPrimaryKeyZero)
+	_, err = DB.BatchUpdate(models, "version")
+	a.ErrorContains(err, "column version cannot be updated")
+	_, err = DB.BatchUpdate(models, "id")
+	a.ErrorContains(err, "column id cannot be updated")
+	_, err = DB.BatchUpdate([]TestModelBase{{}})
+	a.ErrorContains(err, "primary key is not defined")
+	a.Len(rec.SQL(), count)
+}
+
+func TestBatchUpdatePostgres(t *testing.T) {
+	a := assert.New(t)
+
+	var logs []*Log
+	DB, rec := newFakeDB(Options{
+		Dialect: PostgresDialect{},
+		DebugFunc: func(l *Log) {
+			logs = append(logs, l)
+		},
+	})
+
+	tests := []TestModelComposite{
+		{TenantId: "t1", Code: "c1", Name: "foo"},
+		{TenantId: "t1", Code: "c2", Name: "bar"},
+	}
+	affected, err := DB.BatchUpdate(tests)
+	a.Empty(err)
+	a.Equal(int64(2), affected)
+	// 在事务中逐行执行预处理语句
+	SQL := `UPDATE composite SET "name" = $1 WHERE "tenant_id" = $2 AND "code" = $3`
+	a.Equal([]string{"BEGIN", SQL, SQL, "COMMIT"}, rec.SQL())
+	a.Equal([]interface{}{"bar", "t1", "c2"}, rec.Stmts[2].Args)
+	a.Len(logs, 2)
+	a.Equal(1, logs[0].Chunk)
+	a.Equal(2, logs[1].Chunk)
+
+	// 只有一行时不拆分
+	logs = logs[:0]
+	_, err = DB.BatchUpdate(tests[:1])
+	a.Empty(err)
+	a.Len(logs, 1)
+	a.Equal(0, logs[0].Chunk)
+}
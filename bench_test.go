@@ -0,0 +1,48 @@
+package xsql
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+)
+
+// newBenchDB n 行查询结果的数据库
+func newBenchDB(n int) *DB {
+	DB, rec := newFakeDB(Sqlite())
+	bar := time.Date(2022, 4, 14, 23, 49, 48, 0, time.Local)
+	values := make([][]driver.Value, 0, n)
+	for i := 0; i < n; i++ {
+		values = append(values, []driver.Value{int64(i + 1), "foo", bar})
+	}
+	rec.Rows = func(query string) ([]string, [][]driver.Value) {
+		return []string{"id", "foo", "bar"}, values
+	}
+	return DB
+}
+
+func BenchmarkFind(b *testing.B) {
+	DB := newBenchDB(100000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var tests []TestSqlite
+		if err := DB.Find(&tests, "SELECT * FROM xsql"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInsert(b *testing.B) {
+	DB, _ := newFakeDB(Sqlite())
+	test := TestSqlite{
+		Foo: "foo",
+		Bar: time.Now(),
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := DB.Insert(&test); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -6,10 +6,10 @@ import (
 )
 
 type Condition struct {
-	dataType string //Oracle Mysql Mssql Sqlite
-	where    []string
-	order    string
-	limit    string
+	dialect Dialect
+	where   []string
+	order   string
+	limit   string
 }
 
 func (this *Condition) Where(str string) {
@@ -17,13 +17,7 @@ func (this *Condition) Where(str string) {
 }
 
 func (this *Condition) Limit(offset int, size int) {
-	limit := ""
-	switch this.dataType {
-	case "Mysql", "Sqlite":
-		limit = fmt.Sprintf("limit %d,%d", offset, size)
-		break
-	}
-	this.limit = limit
+	this.limit = this.getDialect().Limit(offset, size)
 }
 
 func (this *Condition) Order(fields string, order string) {
@@ -44,17 +38,26 @@ func (this *Condition) Build() string {
 		where += " "
 	}
 
-	var cond string
-	switch this.dataType {
-	case "Mysql", "Sqlite":
-		cond = where + this.order + " " + this.limit
-		break
+	order := this.order
+	if o, ok := this.getDialect().(orderedLimit); ok && order == "" && this.limit != "" {
+		order = o.defaultOrder()
 	}
-	return cond
+	return where + order + " " + this.limit
 }
 
-func NewCondition(dataType string) Condition {
+// getDialect 零值的 Condition 与 NewCondition(nil) 一致使用 mysql
+func (this *Condition) getDialect() Dialect {
+	if this.dialect == nil {
+		return MysqlDialect{}
+	}
+	return this.dialect
+}
+
+func NewCondition(dialect Dialect) Condition {
+	if dialect == nil {
+		dialect = MysqlDialect{}
+	}
 	return Condition{
-		dataType: dataType,
+		dialect: dialect,
 	}
 }
@@ -1,22 +1,15 @@
 package xsql
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"fmt"
 	"reflect"
 	"strings"
 )
 
 var DefaultTimeLayout = "2006-01-02 15:04:05"
 
-// DefaultTimeFunc
-// mysql: return placeholder
-// oracle: return fmt.Sprintf("TO_TIMESTAMP(%s, 'SYYYY-MM-DD HH24:MI:SS:FF6')", placeholder)
-var DefaultTimeFunc = func(placeholder string) string {
-	return placeholder
-}
-
 type QueryRes struct {
 	InsertId int64
 	Affected int64
@@ -31,8 +24,6 @@ func (this QueryRes) RowsAffected() (int64, error) {
 	return this.Affected, nil
 }
 
-type TimeFunc func(placeholder string) string
-
 type DB struct {
 	Options  Options
 	raw      *sql.DB
@@ -62,50 +53,82 @@ func (t *DB) GetRawDB() *sql.DB {
 	return t.raw
 }
 func (t *DB) Insert(data interface{}, opts ...Options) (sql.Result, error) {
+	return t.InsertContext(context.Background(), data, opts...)
+}
+
+func (t *DB) InsertContext(ctx context.Context, data interface{}, opts ...Options) (sql.Result, error) {
 	for _, o := range opts {
 		t.Options.InsertKey = o.InsertKey
 	}
-	return t.executor.Insert(data, &t.Options)
+	return t.executor.Insert(ctx, data, &t.Options)
 }
 
 // 返回最后插入的ID
 func (t *DB) InsertTakeLastId(data interface{}, withSeq string, opts ...Options) (sql.Result, error) {
+	return t.InsertTakeLastIdContext(context.Background(), data, withSeq, opts...)
+}
+
+func (t *DB) InsertTakeLastIdContext(ctx context.Context, data interface{}, withSeq string, opts ...Options) (sql.Result, error) {
 	for _, o := range opts {
 		t.Options.InsertKey = o.InsertKey
 	}
 
-	qr, err := t.executor.InsertTakeLastId(data, withSeq, t.query, &t.Options)
-	if err != nil {
-		return nil, err
-	}
-	table, _ := data.(Table)
-	if table.DBType() == "Oracle" {
-		rows, err := t.GetLastId(data, withSeq)
-		if err != nil {
-			return nil, err
-		}
-		qr = QueryRes{
-			InsertId: rows[0].Get("INSERT_ID").Int(),
-			Affected: 1,
-		}
-		return qr, nil
-	}
-	return qr, nil
+	return t.executor.InsertTakeLastId(ctx, data, withSeq, t.query, &t.Options)
 }
 
 func (t *DB) BatchInsert(data interface{}, opts ...Options) (sql.Result, error) {
+	return t.BatchInsertContext(context.Background(), data, opts...)
+}
+
+func (t *DB) BatchInsertContext(ctx context.Context, data interface{}, opts ...Options) (sql.Result, error) {
 	for _, o := range opts {
 		t.Options.InsertKey = o.InsertKey
 	}
-	return t.executor.BatchInsert(data, &t.Options)
+	return t.executor.BatchInsert(ctx, data, &t.Options)
+}
+
+/*
+@Description: 插入，主键或唯一键冲突时更新
+mysql 使用 ON DUPLICATE KEY UPDATE，oracle、sql server 使用 MERGE，postgresql、sqlite 使用 ON CONFLICT
+@receiver t
+@param data 结构体
+@param conflictColumns 冲突判断的列名，为空时使用主键，mysql 由表的主键及唯一索引判断
+@param updateColumns 冲突时更新的列名，冲突列及 omitempty 的空值不会更新，为空时不更新
+@return sql.Result
+@return error
+*/
+func (t *DB) Upsert(data interface{}, conflictColumns []string, updateColumns []string) (sql.Result, error) {
+	return t.UpsertContext(context.Background(), data, conflictColumns, updateColumns)
+}
+
+func (t *DB) UpsertContext(ctx context.Context, data interface{}, conflictColumns []string, updateColumns []string) (sql.Result, error) {
+	return t.executor.Upsert(ctx, data, conflictColumns, updateColumns, &t.Options)
+}
+
+// BatchUpsert 批量插入，冲突时更新，参数同 Upsert
+func (t *DB) BatchUpsert(data interface{}, conflictColumns []string, updateColumns []string) (sql.Result, error) {
+	return t.BatchUpsertContext(context.Background(), data, conflictColumns, updateColumns)
+}
+
+func (t *DB) BatchUpsertContext(ctx context.Context, data interface{}, conflictColumns []string, updateColumns []string) (sql.Result, error) {
+	return t.executor.Upsert(ctx, data, conflictColumns, updateColumns, &t.Options)
 }
 
 func (t *DB) Update(data interface{}, expr string, args ...interface{}) (sql.Result, error) {
-	return t.executor.Update(data, expr, args, &t.Options)
+	return t.UpdateContext(context.Background(), data, expr, args...)
+}
+
+func (t *DB) UpdateContext(ctx context.Context, data interface{}, expr string, args ...interface{}) (sql.Result, error) {
+	return t.executor.Update(ctx, data, expr, args, &t.Options)
 }
 
+// UpdateRes 更新，未更新任何数据时返回 ErrNoRowsAffected
 func (t *DB) UpdateRes(data interface{}, expr string, args ...interface{}) error {
-	res, err := t.Update(data, expr, args...)
+	return t.UpdateResContext(context.Background(), data, expr, args...)
+}
+
+func (t *DB) UpdateResContext(ctx context.Context, data interface{}, expr string, args ...interface{}) error {
+	res, err := t.UpdateContext(ctx, data, expr, args...)
 	if err != nil {
 		return err
 	}
@@ -114,49 +137,42 @@ func (t *DB) UpdateRes(data interface{}, expr string, args ...interface{}) error
 		return err
 	}
 	if affect == 0 {
-		return errors.New("no affect")
+		return ErrNoRowsAffected
 	}
 	return nil
 }
 
 func (t *DB) Save(data interface{}, orInsert bool, forceFields []string) (sql.Result, error) {
-	_, ok := data.(TableAttribute)
-	if !ok {
-		return nil, errors.New("structure does not implement an interface TableAttribute")
-	}
-	return t.executor.Save(data, orInsert, nil, &t.Options)
+	return t.SaveContext(context.Background(), data, orInsert, forceFields)
+}
+
+func (t *DB) SaveContext(ctx context.Context, data interface{}, orInsert bool, forceFields []string) (sql.Result, error) {
+	return t.executor.Save(ctx, data, orInsert, forceFields, &t.Options)
 }
 
 /*
 @Description: 根据主键删除
 @receiver t
 @param data
-@param primaryVal
+@param primaryVal 主键值，复合主键为按主键顺序的 []interface{}，nil 时使用 data 中的主键值
 @return sql.Result
 @return error
 */
 func (t *DB) DeleteByPrimary(data interface{}, primaryVal any) (sql.Result, error) {
-	tt, ok := data.(TableAttribute)
-	if !ok {
-		return nil, errors.New("should implement an interface TableAttribute")
-	}
-	tableName := tt.TableName()
-	where := ""
-	primaryKey := tt.PrimaryName()
-	switch primaryVal.(type) {
-	case string:
-		where = fmt.Sprintf("WHERE %s = '%s'", primaryKey, primaryVal)
-		break
-	case int, int64:
-		where = fmt.Sprintf("WHERE %s = %d", primaryKey, primaryVal)
-		break
-	}
-	sqlStr := fmt.Sprintf("DELETE FROM %s %s", tableName, where)
-	return t.Exec(sqlStr)
+	return t.DeleteByPrimaryContext(context.Background(), data, primaryVal)
 }
 
+func (t *DB) DeleteByPrimaryContext(ctx context.Context, data interface{}, primaryVal any) (sql.Result, error) {
+	return t.executor.DeleteByPrimary(ctx, data, primaryVal, &t.Options)
+}
+
+// DeleteByPrimaryRes 根据主键删除，未删除任何数据时返回 ErrNoRowsAffected
 func (t *DB) DeleteByPrimaryRes(data interface{}, primaryVal any) error {
-	res, err := t.DeleteByPrimary(data, primaryVal)
+	return t.DeleteByPrimaryResContext(context.Background(), data, primaryVal)
+}
+
+func (t *DB) DeleteByPrimaryResContext(ctx context.Context, data interface{}, primaryVal any) error {
+	res, err := t.DeleteByPrimaryContext(ctx, data, primaryVal)
 	if err != nil {
 		return err
 	}
@@ -165,7 +181,7 @@ func (t *DB) DeleteByPrimaryRes(data interface{}, primaryVal any) error {
 		return err
 	}
 	if affect == 0 {
-		return errors.New("no affect")
+		return ErrNoRowsAffected
 	}
 	return nil
 }
@@ -180,15 +196,48 @@ func (t *DB) DeleteByPrimaryRes(data interface{}, primaryVal any) error {
 @return error
 */
 func (t *DB) UpdateForce(data interface{}, expr string, fields ...string) (sql.Result, error) {
-	return t.executor.UpdateForce(data, expr, fields, &t.Options)
+	return t.UpdateForceContext(context.Background(), data, expr, fields...)
+}
+
+func (t *DB) UpdateForceContext(ctx context.Context, data interface{}, expr string, fields ...string) (sql.Result, error) {
+	return t.executor.UpdateForce(ctx, data, expr, fields, &t.Options)
+}
+
+/*
+@Description: 根据主键批量更新，每行的值可以不同
+@receiver t
+@param data 结构体数组/切片
+@param columns 更新的列名，为空时更新全部可写入的非主键字段并忽略 omitempty 的空值，指定时空值同样更新
+@return int64 影响的行数
+@return error
+*/
+func (t *DB) BatchUpdate(data interface{}, columns ...string) (int64, error) {
+	return t.BatchUpdateContext(context.Background(), data, columns...)
+}
+
+func (t *DB) BatchUpdateContext(ctx context.Context, data interface{}, columns ...string) (int64, error) {
+	return t.executor.BatchUpdate(ctx, data, columns, &t.Options)
 }
 
 func (t *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
-	return t.executor.Exec(query, args, &t.Options)
+	return t.ExecContext(context.Background(), query, args...)
+}
+
+func (t *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	query, args, err := t.bind(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return t.executor.Exec(ctx, query, args, &t.Options)
 }
 
 func (t *DB) Begin() (*Tx, error) {
-	tx, err := t.raw.Begin()
+	return t.BeginTx(context.Background(), nil)
+}
+
+// BeginTx 开启事务，ctx 取消时事务自动回滚
+func (t *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := t.raw.BeginTx(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -207,7 +256,15 @@ func (t *DB) Begin() (*Tx, error) {
 }
 
 func (t *DB) Query(query string, args ...interface{}) ([]Row, error) {
-	f, err := t.query.Fetch(query, args, &t.Options)
+	return t.QueryContext(context.Background(), query, args...)
+}
+
+func (t *DB) QueryContext(ctx context.Context, query string, args ...interface{}) ([]Row, error) {
+	query, args, err := t.bind(query, args)
+	if err != nil {
+		return nil, err
+	}
+	f, err := t.query.Fetch(ctx, query, args, &t.Options)
 	if err != nil {
 		return nil, err
 	}
@@ -219,7 +276,15 @@ func (t *DB) Query(query string, args ...interface{}) ([]Row, error) {
 }
 
 func (t *DB) Find(i interface{}, query string, args ...interface{}) error {
-	f, err := t.query.Fetch(query, args, &t.Options)
+	return t.FindContext(context.Background(), i, query, args...)
+}
+
+func (t *DB) FindContext(ctx context.Context, i interface{}, query string, args ...interface{}) error {
+	query, args, err := t.bind(query, args)
+	if err != nil {
+		return err
+	}
+	f, err := t.query.Fetch(ctx, query, args, &t.Options)
 	if err != nil {
 		return err
 	}
@@ -230,8 +295,16 @@ func (t *DB) Find(i interface{}, query string, args ...interface{}) error {
 }
 
 func (t *DB) First(i interface{}, query string, args ...interface{}) error {
+	return t.FirstContext(context.Background(), i, query, args...)
+}
+
+func (t *DB) FirstContext(ctx context.Context, i interface{}, query string, args ...interface{}) error {
 	query = t.tableComplete(i, query)
-	f, err := t.query.Fetch(query, args, &t.Options)
+	query, args, err := t.bind(query, args)
+	if err != nil {
+		return err
+	}
+	f, err := t.query.Fetch(ctx, query, args, &t.Options)
 	if err != nil {
 		return err
 	}
@@ -241,21 +314,70 @@ func (t *DB) First(i interface{}, query string, args ...interface{}) error {
 	return nil
 }
 
-func (t *DB) GetLastId(data any, seq string) ([]Row, error) {
-	table, _ := data.(Table)
-	switch table.DBType() {
-	case "Oracle":
-		sqlStr := fmt.Sprintf(`SELECT %s.CURRVAL INSERT_ID FROM DUAL`, seq)
-		return t.Query(sqlStr)
-	case "Mssql":
-		sqlStr := fmt.Sprintf(`Select SCOPE_IDENTITY() INSERT_ID`)
-		return t.Query(sqlStr)
+/*
+@Description: 逐行读取查询结果，适用于数据量较大、无法一次性加载的查询
+@receiver t
+@param ctx
+@param query
+@param args
+@param fn 返回错误时停止读取并返回该错误
+@return error
+*/
+func (t *DB) Each(ctx context.Context, query string, args []interface{}, fn func(row Row) error) error {
+	query, args, err := t.bind(query, args)
+	if err != nil {
+		return err
+	}
+	f, err := t.query.Fetch(ctx, query, args, &t.Options)
+	if err != nil {
+		return err
+	}
+	return f.Each(fn)
+}
 
+/*
+@Description: 逐行读取查询结果并映射到结构体 i 后调用 fn，i 在每行映射前重置为零值
+@receiver t
+@param ctx
+@param i 结构体指针
+@param query
+@param args
+@param fn 返回错误时停止读取并返回该错误
+@return error
+*/
+func (t *DB) Iterate(ctx context.Context, i interface{}, query string, args []interface{}, fn func() error) error {
+	query, args, err := t.bind(query, args)
+	if err != nil {
+		return err
+	}
+	f, err := t.query.Fetch(ctx, query, args, &t.Options)
+	if err != nil {
+		return err
+	}
+	return f.Iterate(i, fn)
+}
+
+// GetLastId 查询序列当前值，仅适用于插入后查询自增ID的方言，如 oracle
+func (t *DB) GetLastId(seq string) ([]Row, error) {
+	return t.GetLastIdContext(context.Background(), seq)
+}
+
+func (t *DB) GetLastIdContext(ctx context.Context, seq string) ([]Row, error) {
+	strategy, sqlStr := t.Options.dialect().LastInsertId(InsertSQL{}, "", seq)
+	if strategy != LastIdFollow {
+		return nil, errors.New("未查到序列自增值")
 	}
-	return nil, errors.New("未查到序列自增值")
+	return t.QueryContext(ctx, sqlStr)
 }
-func (t *DB) NewCondition(dataType string) Condition {
-	return NewCondition(dataType)
+
+// NewCondition 使用当前方言构建条件
+func (t *DB) NewCondition() Condition {
+	return NewCondition(t.Options.dialect())
+}
+
+// bind 按方言改写 SQL 中的占位符并整理参数，如 RewritePlaceholder、命名参数
+func (t *DB) bind(query string, args []interface{}) (string, []interface{}, error) {
+	return newPlaceholders(t.Options.dialect()).bind(query, args, t.Options.RewritePlaceholder)
 }
 
 func (t *DB) tableComplete(i interface{}, query string) string {
@@ -1,3 +1,5 @@
+//go:build oracle
+
 package xsql
 
 import (
@@ -72,8 +74,7 @@ func TestOracleInsert(t *testing.T) {
 	a.Empty(err)
 }
 
-// oracle 不支持批量插入
-func _TestOracleBatchInsert(t *testing.T) {
+func TestOracleBatchInsert(t *testing.T) {
 	a := assert.New(t)
 
 	DB := newOracleDB()
@@ -0,0 +1,537 @@
+package xsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"log"
+	_ "modernc.org/sqlite"
+	"testing"
+	"time"
+)
+
+func newSqliteDB() *DB {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		log.Fatal(err)
+	}
+	// 内存数据库每个连接相互独立
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE xsql (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		foo VARCHAR(255) DEFAULT NULL,
+		bar DATETIME DEFAULT NULL
+	)`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO xsql (id, foo, bar) VALUES (1, 'v', '2022-04-14 23:49:48'), (2, 'v1', '2022-04-14 23:50:00')`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts := Sqlite()
+	opts.DebugFunc = func(l *Log) {
+		log.Println(l)
+	}
+	return New(db, opts)
+}
+
+type TestSqlite struct {
+	Id  int       `xsql:"id,omitempty"`
+	Foo string    `xsql:"foo"`
+	Bar time.Time `xsql:"bar"`
+}
+
+func (t TestSqlite) TableName() string {
+	return "xsql"
+}
+
+func (t TestSqlite) PrimaryName() string {
+	return "id"
+}
+
+func (t TestSqlite) String() string {
+	return fmt.Sprintf("{Id:%d Foo:%s Bar:%s}", t.Id, t.Foo, t.Bar.Format(DefaultTimeLayout))
+}
+
+func TestSqliteQuery(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	rows, err := DB.Query("SELECT * FROM xsql")
+	a.Empty(err)
+	a.Len(rows, 2)
+	a.Equal("v", rows[0].Get("foo").String())
+	a.Equal("2022-04-14 23:49:48", rows[0].Get("bar").Time().Format(DefaultTimeLayout))
+}
+
+func TestSqliteInsert(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	test := TestSqlite{
+		Foo: "test",
+		Bar: time.Now(),
+	}
+	res, err := DB.Insert(&test)
+	a.Empty(err)
+	id, _ := res.LastInsertId()
+	a.Equal(int64(3), id)
+
+	var result TestSqlite
+	err = DB.First(&result, "SELECT * FROM xsql WHERE id = ?", 3)
+	a.Empty(err)
+	a.Equal("test", result.Foo)
+	a.Equal(test.Bar.Format(DefaultTimeLayout), result.Bar.Format(DefaultTimeLayout))
+}
+
+func TestSqliteInsertTakeLastId(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	res, err := DB.InsertTakeLastId(&TestSqlite{Foo: "test", Bar: time.Now()}, "")
+	a.Empty(err)
+	id, _ := res.LastInsertId()
+	a.Equal(int64(3), id)
+}
+
+func TestSqliteBatchInsert(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	tests := []TestSqlite{
+		{
+			Id:  3,
+			Foo: "test",
+			Bar: time.Now(),
+		},
+		{
+			Id:  4,
+			Foo: "test",
+			Bar: time.Now(),
+		},
+		// omitempty 的 id 由数据库生成
+		{
+			Foo: "test",
+			Bar: time.Now(),
+		},
+	}
+	res, err := DB.BatchInsert(&tests)
+	a.Empty(err)
+	affected, _ := res.RowsAffected()
+	a.Equal(int64(3), affected)
+
+	var results []TestSqlite
+	err = DB.Find(&results, "SELECT * FROM xsql ORDER BY id")
+	a.Empty(err)
+	a.Len(results, 5)
+	a.Equal(5, results[4].Id)
+}
+
+func TestSqliteUpdate(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	test := TestSqlite{
+		Foo: "test update",
+		Bar: time.Now(),
+	}
+	res, err := DB.Update(&test, "id = ?", 2)
+	a.Empty(err)
+	affected, _ := res.RowsAffected()
+	a.Equal(int64(1), affected)
+
+	var result TestSqlite
+	err = DB.First(&result, "SELECT * FROM xsql WHERE id = ?", 2)
+	a.Empty(err)
+	a.Equal("test update", result.Foo)
+}
+
+func TestSqliteSave(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	test := TestSqlite{
+		Id:  1,
+		Foo: "test save",
+		Bar: time.Now(),
+	}
+	_, err := DB.Save(&test, false, nil)
+	a.Empty(err)
+
+	var result TestSqlite
+	err = DB.First(&result, "SELECT * FROM xsql WHERE id = ?", 1)
+	a.Empty(err)
+	a.Equal("test save", result.Foo)
+
+	test = TestSqlite{
+		Foo: "test save insert",
+		Bar: time.Now(),
+	}
+	_, err = DB.Save(&test, true, nil)
+	a.Empty(err)
+
+	err = DB.First(&result, "SELECT * FROM xsql WHERE id = ?", 3)
+	a.Empty(err)
+	a.Equal("test save insert", result.Foo)
+}
+
+func TestSqliteBatchUpdate(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	bar := time.Date(2022, 4, 15, 0, 0, 0, 0, time.Local)
+	tests := []TestSqlite{
+		{Id: 1, Foo: "test batch 1", Bar: bar},
+		{Id: 2, Foo: "test batch 2"},
+		{Id: 3, Foo: "not exists"},
+	}
+	affected, err := DB.BatchUpdate(tests, "foo")
+	a.Empty(err)
+	a.Equal(int64(2), affected)
+
+	var results []TestSqlite
+	err = DB.Find(&results, "SELECT * FROM xsql ORDER BY id")
+	a.Empty(err)
+	a.Equal("test batch 1", results[0].Foo)
+	a.Equal("test batch 2", results[1].Foo)
+	// 未指定的列不更新
+	a.Equal("2022-04-14 23:49:48", results[0].Bar.Format(DefaultTimeLayout))
+
+	affected, err = DB.BatchUpdate(tests[:1])
+	a.Empty(err)
+	a.Equal(int64(1), affected)
+	err = DB.First(&results[0], "SELECT * FROM xsql WHERE id = ?", 1)
+	a.Empty(err)
+	a.Equal(bar.Format(DefaultTimeLayout), results[0].Bar.Format(DefaultTimeLayout))
+}
+
+func TestSqliteUpsert(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	test := TestSqlite{
+		Id:  1,
+		Foo: "test upsert",
+		Bar: time.Now(),
+	}
+	// 冲突列为空时使用主键，冲突列不会更新
+	_, err := DB.Upsert(&test, nil, []string{"id", "foo"})
+	a.Empty(err)
+
+	var result TestSqlite
+	err = DB.First(&result, "SELECT * FROM xsql WHERE id = ?", 1)
+	a.Empty(err)
+	a.Equal("test upsert", result.Foo)
+
+	tests := []TestSqlite{
+		{Id: 2, Foo: "ignored"},
+		{Id: 3, Foo: "test insert"},
+	}
+	_, err = DB.BatchUpsert(&tests, []string{"id"}, nil)
+	a.Empty(err)
+
+	var results []TestSqlite
+	err = DB.Find(&results, "SELECT * FROM xsql WHERE id >= ? ORDER BY id", 2)
+	a.Empty(err)
+	a.Len(results, 2)
+	a.Equal("v1", results[0].Foo)
+	a.Equal("test insert", results[1].Foo)
+
+	// 主键为空值时不插入，无法判断冲突
+	_, err = DB.Upsert(&TestSqlite{Foo: "foo"}, nil, []string{"foo"})
+	a.ErrorContains(err, "conflict column id is not inserted")
+	_, err = DB.Upsert(&TestSqlite{Foo: "foo"}, nil, []string{"unknown"})
+	a.ErrorContains(err, "update column unknown cannot be updated")
+}
+
+func TestSqliteExec(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	res, err := DB.Exec("DELETE FROM xsql WHERE id = ?", 2)
+	a.Empty(err)
+	affected, _ := res.RowsAffected()
+	a.Equal(int64(1), affected)
+}
+
+func TestSqliteFirst(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	var test TestSqlite
+	err := DB.First(&test, "SELECT * FROM xsql")
+	a.Empty(err)
+
+	a.Equal("{Id:1 Foo:v Bar:2022-04-14 23:49:48}", test.String())
+}
+
+func TestSqliteFirstPart(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	var test TestSqlite
+	err := DB.First(&test, "SELECT foo FROM xsql")
+	a.Empty(err)
+
+	a.Equal("{Id:0 Foo:v Bar:0001-01-01 00:00:00}", test.String())
+}
+
+func TestSqliteFind(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	var tests []TestSqlite
+	err := DB.Find(&tests, "SELECT * FROM xsql LIMIT 2")
+	a.Empty(err)
+
+	a.Equal(`[{Id:1 Foo:v Bar:2022-04-14 23:49:48} {Id:2 Foo:v1 Bar:2022-04-14 23:50:00}]`, fmt.Sprintf("%v", tests))
+}
+
+func TestSqliteFindPart(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	var tests []TestSqlite
+	err := DB.Find(&tests, "SELECT foo FROM xsql LIMIT 2")
+	a.Empty(err)
+
+	a.Equal(`[{Id:0 Foo:v Bar:0001-01-01 00:00:00} {Id:0 Foo:v1 Bar:0001-01-01 00:00:00}]`, fmt.Sprintf("%v", tests))
+}
+
+func TestSqliteCondition(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	cond := DB.NewCondition()
+	cond.Where("id > ?")
+	cond.Order("id", "asc")
+	cond.Limit(0, 1)
+
+	var tests []TestSqlite
+	err := DB.Find(&tests, "SELECT * FROM xsql "+cond.Build(), 0)
+	a.Empty(err)
+	a.Len(tests, 1)
+	a.Equal(1, tests[0].Id)
+}
+
+func TestSqliteNamedArgs(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	var tests []TestSqlite
+	err := DB.Find(&tests, "SELECT * FROM xsql WHERE foo = :foo OR (id > :id AND foo <> :foo)", map[string]interface{}{
+		"foo": "v",
+		"id":  1,
+	})
+	a.Empty(err)
+	a.Len(tests, 2)
+
+	var test TestSqlite
+	err = DB.First(&test, "SELECT * FROM xsql WHERE foo = :foo", TestSqlite{Foo: "v1"})
+	a.Empty(err)
+	a.Equal(2, test.Id)
+
+	_, err = DB.Update(&TestSqlite{Foo: "test update", Bar: time.Now()}, "id = :id", map[string]interface{}{"id": 2})
+	a.Empty(err)
+
+	_, err = DB.Exec("DELETE FROM xsql WHERE foo = :foo", map[string]interface{}{"foo": "test update"})
+	a.Empty(err)
+
+	rows, err := DB.Query("SELECT * FROM xsql WHERE id >= :id", map[string]interface{}{"id": 1})
+	a.Empty(err)
+	a.Len(rows, 1)
+}
+
+func TestSqliteTxCommit(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	tx, err := DB.Begin()
+	a.Empty(err)
+
+	test := TestSqlite{
+		Foo: "test",
+		Bar: time.Now(),
+	}
+	_, err = tx.Insert(&test)
+	a.Empty(err)
+
+	err = tx.Commit()
+	a.Empty(err)
+
+	rows, err := DB.Query("SELECT * FROM xsql")
+	a.Empty(err)
+	a.Len(rows, 3)
+}
+
+func TestSqliteTxRollback(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	tx, err := DB.Begin()
+	a.Empty(err)
+
+	test := TestSqlite{
+		Foo: "test",
+		Bar: time.Now(),
+	}
+	_, err = tx.Insert(&test)
+	a.Empty(err)
+
+	err = tx.Rollback()
+	a.Empty(err)
+
+	rows, err := DB.Query("SELECT * FROM xsql")
+	a.Empty(err)
+	a.Len(rows, 2)
+}
+
+func TestSqliteSliceArgs(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	var tests []TestSqlite
+	err := DB.Find(&tests, "SELECT * FROM xsql WHERE id IN (?) AND foo <> ?", []int{1, 2, 3}, "")
+	a.Empty(err)
+	a.Len(tests, 2)
+
+	res, err := DB.Exec("DELETE FROM xsql WHERE id IN (?)", []int{1, 2})
+	a.Empty(err)
+	affected, _ := res.RowsAffected()
+	a.Equal(int64(2), affected)
+
+	_, err = DB.Query("SELECT * FROM xsql WHERE id IN (?)", []int{})
+	a.EqualError(err, "sql: empty slice for placeholder ?")
+}
+
+func TestSqliteContext(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var tests []TestSqlite
+	err := DB.FindContext(ctx, &tests, "SELECT * FROM xsql")
+	a.Empty(err)
+	a.Len(tests, 2)
+
+	cancel()
+	_, err = DB.QueryContext(ctx, "SELECT * FROM xsql")
+	a.ErrorIs(err, context.Canceled)
+	_, err = DB.InsertContext(ctx, &TestSqlite{Foo: "test", Bar: time.Now()})
+	a.ErrorIs(err, context.Canceled)
+	_, err = DB.BeginTx(ctx, nil)
+	a.ErrorIs(err, context.Canceled)
+}
+
+func TestSqliteTxContext(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tx, err := DB.BeginTx(ctx, nil)
+	a.Empty(err)
+
+	_, err = tx.InsertContext(ctx, &TestSqlite{Foo: "test", Bar: time.Now()})
+	a.Empty(err)
+
+	// 取消后事务自动回滚
+	cancel()
+	a.Error(tx.Commit())
+}
+
+func TestSqliteEach(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+	var logs []*Log
+	DB.Options.DebugFunc = func(l *Log) {
+		logs = append(logs, l)
+	}
+
+	foos := make([]string, 0)
+	err := DB.Each(context.Background(), "SELECT * FROM xsql WHERE id > ? ORDER BY id", []interface{}{0}, func(row Row) error {
+		foos = append(foos, row.Get("foo").String())
+		return nil
+	})
+	a.Empty(err)
+	a.Equal([]string{"v", "v1"}, foos)
+	a.Len(logs, 1)
+	a.Equal(int64(2), logs[0].RowsAffected)
+
+	// 提前结束时关闭结果集，连接可以继续使用
+	errStop := errors.New("stop")
+	err = DB.Each(context.Background(), "SELECT * FROM xsql ORDER BY id", nil, func(row Row) error {
+		return errStop
+	})
+	a.ErrorIs(err, errStop)
+	a.Equal(int64(1), logs[1].RowsAffected)
+
+	rows, err := DB.Query("SELECT * FROM xsql")
+	a.Empty(err)
+	a.Len(rows, 2)
+}
+
+func TestSqliteIterate(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	var test TestSqlite
+	tests := make([]string, 0)
+	err := DB.Iterate(context.Background(), &test, "SELECT * FROM xsql ORDER BY id", nil, func() error {
+		tests = append(tests, test.String())
+		return nil
+	})
+	a.Empty(err)
+	a.Equal([]string{"{Id:1 Foo:v Bar:2022-04-14 23:49:48}", "{Id:2 Foo:v1 Bar:2022-04-14 23:50:00}"}, tests)
+
+	// 每行映射前重置为零值
+	_, err = DB.Exec("INSERT INTO xsql (id) VALUES (3)")
+	a.Empty(err)
+	err = DB.Iterate(context.Background(), &test, "SELECT * FROM xsql WHERE id >= ? ORDER BY id", []interface{}{2}, func() error {
+		if test.Id == 3 {
+			a.Equal("", test.Foo)
+		}
+		return nil
+	})
+	a.Empty(err)
+
+	err = DB.Iterate(context.Background(), test, "SELECT * FROM xsql", nil, func() error {
+		return nil
+	})
+	a.Error(err)
+
+	tx, err := DB.Begin()
+	a.Empty(err)
+	count := 0
+	err = tx.Iterate(context.Background(), &test, "SELECT * FROM xsql", nil, func() error {
+		count++
+		return nil
+	})
+	a.Empty(err)
+	a.Equal(3, count)
+	a.Empty(tx.Commit())
+}
@@ -0,0 +1,365 @@
+package xsql
+
+import (
+	"fmt"
+	ora "github.com/sijms/go-ora/v2"
+	"strings"
+	"time"
+)
+
+// Dialect 数据库方言
+// 统一处理各数据库在占位符、字段引用、分页、自增ID、参数绑定、upsert 语法上的差异
+type Dialect interface {
+	// Name 方言名称
+	Name() string
+
+	// Placeholder 第 n 个绑定参数的占位符，n 从 1 开始
+	Placeholder(n int) string
+
+	// Quote 引用字段名
+	Quote(name string) string
+
+	// Limit 分页语句
+	Limit(offset int, size int) string
+
+	// LastInsertId 获取自增ID的方式
+	// LastIdResult: 使用 sql.Result.LastInsertId()，返回的 sql 为空
+	// LastIdReturning: 返回改写后的插入语句，查询结果即为自增ID
+	// LastIdFollow: 返回插入成功后需要执行的查询语句
+	LastInsertId(insert InsertSQL, primary string, seq string) (LastIdStrategy, string)
+
+	// Bind 参数绑定，返回包装后的占位符及实际绑定的值
+	// 例如时间格式化、oracle 的 TO_TIMESTAMP
+	Bind(placeholder string, v interface{}, timeLayout string) (string, interface{})
+
+	// Upsert 主键或唯一键冲突时更新的插入语句
+	// conflict: 冲突判断字段，update: 冲突时更新的字段，均未引用
+	Upsert(insert InsertSQL, conflict []string, update []string) string
+
+	// Savepoint 保存点语句：创建、回滚到保存点、释放，不支持释放的方言 release 为空
+	Savepoint(name string) (create string, rollback string, release string)
+
+	// Retryable 是否为死锁、锁等待超时等重新执行即可能成功的临时错误
+	Retryable(err error) bool
+
+	// Classify 数据库错误对应的分类错误，如 ErrDuplicateKey，无法分类时返回 nil
+	Classify(err error) error
+}
+
+// orderedLimit 分页语句必须带有排序的方言
+type orderedLimit interface {
+	defaultOrder() string
+}
+
+// LastIdStrategy 获取自增ID的方式
+type LastIdStrategy int
+
+const (
+	LastIdResult LastIdStrategy = iota
+	LastIdReturning
+	LastIdFollow
+)
+
+// InsertSQL 插入语句的组成部分
+type InsertSQL struct {
+	// INSERT INTO / REPLACE INTO
+	Key   string
+	Table string
+	// 已引用的字段名
+	Columns []string
+	// 每行的占位符
+	Values [][]string
+}
+
+func (t InsertSQL) String() string {
+	return fmt.Sprintf(`%s %s (%s) VALUES %s`, t.Key, t.Table, strings.Join(t.Columns, ", "), t.rows())
+}
+
+func (t InsertSQL) rows() string {
+	rows := make([]string, 0, len(t.Values))
+	for _, vars := range t.Values {
+		rows = append(rows, fmt.Sprintf("(%s)", strings.Join(vars, ", ")))
+	}
+	return strings.Join(rows, ", ")
+}
+
+// MysqlDialect mysql 方言，默认方言
+type MysqlDialect struct{}
+
+func (MysqlDialect) Name() string {
+	return "mysql"
+}
+
+func (MysqlDialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (MysqlDialect) Quote(name string) string {
+	return "`" + name + "`"
+}
+
+func (MysqlDialect) Limit(offset int, size int) string {
+	return fmt.Sprintf("limit %d,%d", offset, size)
+}
+
+func (MysqlDialect) LastInsertId(insert InsertSQL, primary string, seq string) (LastIdStrategy, string) {
+	return LastIdResult, ""
+}
+
+func (MysqlDialect) Bind(placeholder string, v interface{}, timeLayout string) (string, interface{}) {
+	if ti, ok := v.(time.Time); ok {
+		return placeholder, ti.Format(timeLayout)
+	}
+	return placeholder, v
+}
+
+// Upsert 不使用 conflict，由表的主键及唯一索引判断冲突，update 为空时更新为原值，即不做修改
+func (d MysqlDialect) Upsert(insert InsertSQL, conflict []string, update []string) string {
+	set := make([]string, 0, len(update))
+	for _, c := range update {
+		set = append(set, fmt.Sprintf("%s = VALUES(%s)", d.Quote(c), d.Quote(c)))
+	}
+	if len(set) == 0 {
+		column := insert.Columns[0]
+		if len(conflict) > 0 {
+			column = d.Quote(conflict[0])
+		}
+		set = append(set, fmt.Sprintf("%s = %s", column, column))
+	}
+	return fmt.Sprintf("%s ON DUPLICATE KEY UPDATE %s", insert, strings.Join(set, ", "))
+}
+
+func (MysqlDialect) Savepoint(name string) (string, string, string) {
+	return "SAVEPOINT " + name, "ROLLBACK TO SAVEPOINT " + name, "RELEASE SAVEPOINT " + name
+}
+
+// OracleDialect oracle 方言
+type OracleDialect struct{}
+
+func (OracleDialect) Name() string {
+	return "oracle"
+}
+
+func (OracleDialect) Placeholder(n int) string {
+	return fmt.Sprintf(":%d", n)
+}
+
+func (OracleDialect) Quote(name string) string {
+	return `"` + name + `"`
+}
+
+// Limit 需要 oracle 12c 及以上版本
+func (OracleDialect) Limit(offset int, size int) string {
+	return fmt.Sprintf("offset %d rows fetch next %d rows only", offset, size)
+}
+
+func (OracleDialect) LastInsertId(insert InsertSQL, primary string, seq string) (LastIdStrategy, string) {
+	return LastIdFollow, fmt.Sprintf(`SELECT %s.CURRVAL INSERT_ID FROM DUAL`, seq)
+}
+
+// Bind 超过 VARCHAR2、RAW 长度限制的字符串、[]byte 以 CLOB、BLOB 绑定
+func (OracleDialect) Bind(placeholder string, v interface{}, timeLayout string) (string, interface{}) {
+	switch val := v.(type) {
+	case time.Time:
+		return fmt.Sprintf("TO_TIMESTAMP(%s, 'SYYYY-MM-DD HH24:MI:SS:FF6')", placeholder), val.Format(timeLayout)
+	case string:
+		if len(val) > 4000 {
+			return placeholder, ora.Clob{String: val, Valid: true}
+		}
+	case []uint8:
+		// 空的 BLOB 需要以空字符串绑定
+		if len(val) == 0 {
+			return placeholder, ""
+		}
+		if len(val) > 2000 {
+			return placeholder, ora.Blob{Data: val, Valid: true}
+		}
+	}
+	return placeholder, v
+}
+
+func (d OracleDialect) Upsert(insert InsertSQL, conflict []string, update []string) string {
+	rows := make([]string, 0, len(insert.Values))
+	for _, vars := range insert.Values {
+		selects := make([]string, 0, len(vars))
+		for i, v := range vars {
+			selects = append(selects, fmt.Sprintf("%s %s", v, insert.Columns[i]))
+		}
+		rows = append(rows, fmt.Sprintf("SELECT %s FROM DUAL", strings.Join(selects, ", ")))
+	}
+	source := fmt.Sprintf("(%s) s", strings.Join(rows, " UNION ALL "))
+	return merge(d, insert, source, conflict, update)
+}
+
+// Savepoint oracle 不支持释放保存点
+func (OracleDialect) Savepoint(name string) (string, string, string) {
+	return "SAVEPOINT " + name, "ROLLBACK TO SAVEPOINT " + name, ""
+}
+
+// MssqlDialect sql server 方言
+type MssqlDialect struct{}
+
+func (MssqlDialect) Name() string {
+	return "mssql"
+}
+
+func (MssqlDialect) Placeholder(n int) string {
+	return fmt.Sprintf("@p%d", n)
+}
+
+func (MssqlDialect) Quote(name string) string {
+	return "[" + name + "]"
+}
+
+// Limit 需要 sql server 2012 及以上版本，且必须带有排序
+func (MssqlDialect) Limit(offset int, size int) string {
+	return fmt.Sprintf("offset %d rows fetch next %d rows only", offset, size)
+}
+
+func (MssqlDialect) defaultOrder() string {
+	return "order by (select null)"
+}
+
+// LastInsertId 通过 OUTPUT INSERTED 返回主键，未指定主键时在同一批次中查询 SCOPE_IDENTITY()
+func (d MssqlDialect) LastInsertId(insert InsertSQL, primary string, seq string) (LastIdStrategy, string) {
+	if primary == "" {
+		return LastIdReturning, insert.String() + "; SELECT SCOPE_IDENTITY() INSERT_ID"
+	}
+	return LastIdReturning, fmt.Sprintf(`%s %s (%s) OUTPUT INSERTED.%s VALUES %s`, insert.Key, insert.Table, strings.Join(insert.Columns, ", "), d.Quote(primary), insert.rows())
+}
+
+func (MssqlDialect) Bind(placeholder string, v interface{}, timeLayout string) (string, interface{}) {
+	if ti, ok := v.(time.Time); ok {
+		return placeholder, ti.Format(timeLayout)
+	}
+	return placeholder, v
+}
+
+func (d MssqlDialect) Upsert(insert InsertSQL, conflict []string, update []string) string {
+	source := fmt.Sprintf("(VALUES %s) AS s (%s)", insert.rows(), strings.Join(insert.Columns, ", "))
+	return merge(d, insert, source, conflict, update) + ";"
+}
+
+// Savepoint sql server 不支持释放保存点
+func (MssqlDialect) Savepoint(name string) (string, string, string) {
+	return "SAVE TRANSACTION " + name, "ROLLBACK TRANSACTION " + name, ""
+}
+
+// merge 生成 MERGE INTO 语句，source 为别名是 s 的数据源，oracle 不能更新 ON 中的列，update 中的冲突列会被忽略
+func merge(d Dialect, insert InsertSQL, source string, conflict []string, update []string) string {
+	on := make([]string, 0, len(conflict))
+	keys := make(map[string]bool, len(conflict))
+	for _, c := range conflict {
+		on = append(on, fmt.Sprintf("t.%s = s.%s", d.Quote(c), d.Quote(c)))
+		keys[c] = true
+	}
+	set := make([]string, 0, len(update))
+	for _, c := range update {
+		if keys[c] {
+			continue
+		}
+		set = append(set, fmt.Sprintf("t.%s = s.%s", d.Quote(c), d.Quote(c)))
+	}
+	values := make([]string, 0, len(insert.Columns))
+	for _, c := range insert.Columns {
+		values = append(values, "s."+c)
+	}
+
+	SQL := fmt.Sprintf("MERGE INTO %s t USING %s ON (%s)", insert.Table, source, strings.Join(on, " AND "))
+	if len(set) > 0 {
+		SQL += fmt.Sprintf(" WHEN MATCHED THEN UPDATE SET %s", strings.Join(set, ", "))
+	}
+	SQL += fmt.Sprintf(" WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)", strings.Join(insert.Columns, ", "), strings.Join(values, ", "))
+	return SQL
+}
+
+// PostgresDialect postgresql 方言
+type PostgresDialect struct{}
+
+func (PostgresDialect) Name() string {
+	return "postgres"
+}
+
+func (PostgresDialect) Placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func (PostgresDialect) Quote(name string) string {
+	return `"` + name + `"`
+}
+
+func (PostgresDialect) Limit(offset int, size int) string {
+	return fmt.Sprintf("limit %d offset %d", size, offset)
+}
+
+// LastInsertId 通过 RETURNING 返回主键，未指定主键时驱动需支持 LastInsertId
+func (d PostgresDialect) LastInsertId(insert InsertSQL, primary string, seq string) (LastIdStrategy, string) {
+	if primary == "" {
+		return LastIdResult, ""
+	}
+	return LastIdReturning, fmt.Sprintf("%s RETURNING %s", insert, d.Quote(primary))
+}
+
+// Bind 时间直接交由驱动绑定
+func (PostgresDialect) Bind(placeholder string, v interface{}, timeLayout string) (string, interface{}) {
+	return placeholder, v
+}
+
+func (d PostgresDialect) Upsert(insert InsertSQL, conflict []string, update []string) string {
+	on := make([]string, 0, len(conflict))
+	for _, c := range conflict {
+		on = append(on, d.Quote(c))
+	}
+	if len(update) == 0 {
+		return fmt.Sprintf("%s ON CONFLICT (%s) DO NOTHING", insert, strings.Join(on, ", "))
+	}
+	set := make([]string, 0, len(update))
+	for _, c := range update {
+		set = append(set, fmt.Sprintf("%s = EXCLUDED.%s", d.Quote(c), d.Quote(c)))
+	}
+	return fmt.Sprintf("%s ON CONFLICT (%s) DO UPDATE SET %s", insert, strings.Join(on, ", "), strings.Join(set, ", "))
+}
+
+func (PostgresDialect) Savepoint(name string) (string, string, string) {
+	return "SAVEPOINT " + name, "ROLLBACK TO SAVEPOINT " + name, "RELEASE SAVEPOINT " + name
+}
+
+// SqliteDialect sqlite 方言
+type SqliteDialect struct{}
+
+func (SqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (SqliteDialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (SqliteDialect) Quote(name string) string {
+	return `"` + name + `"`
+}
+
+func (SqliteDialect) Limit(offset int, size int) string {
+	return fmt.Sprintf("limit %d offset %d", size, offset)
+}
+
+// LastInsertId 驱动的 LastInsertId 即 last_insert_rowid()，且与插入语句使用同一连接
+func (SqliteDialect) LastInsertId(insert InsertSQL, primary string, seq string) (LastIdStrategy, string) {
+	return LastIdResult, ""
+}
+
+// Bind 时间以文本格式存储，与 sqlite 的 datetime() 函数格式一致
+func (SqliteDialect) Bind(placeholder string, v interface{}, timeLayout string) (string, interface{}) {
+	if ti, ok := v.(time.Time); ok {
+		return placeholder, ti.Format(timeLayout)
+	}
+	return placeholder, v
+}
+
+func (SqliteDialect) Upsert(insert InsertSQL, conflict []string, update []string) string {
+	return PostgresDialect{}.Upsert(insert, conflict, update)
+}
+
+func (SqliteDialect) Savepoint(name string) (string, string, string) {
+	return "SAVEPOINT " + name, "ROLLBACK TO SAVEPOINT " + name, "RELEASE SAVEPOINT " + name
+}
@@ -0,0 +1,81 @@
+package xsql
+
+import (
+	"database/sql/driver"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type TestMssql struct {
+	Id  int       `xsql:"id,omitempty"`
+	Foo string    `xsql:"foo"`
+	Bar time.Time `xsql:"bar"`
+}
+
+func (t TestMssql) TableName() string {
+	return "xsql"
+}
+
+func (t TestMssql) PrimaryName() string {
+	return "id"
+}
+
+func TestMssqlInsert(t *testing.T) {
+	a := assert.New(t)
+
+	DB, rec := newFakeDB(Mssql())
+
+	_, err := DB.Insert(&TestMssql{Foo: "test", Bar: time.Now()})
+	a.Empty(err)
+
+	a.Equal(`INSERT INTO xsql ([foo], [bar]) VALUES (@p1, @p2)`, rec.Last().SQL)
+}
+
+func TestMssqlBatchInsert(t *testing.T) {
+	a := assert.New(t)
+
+	DB, rec := newFakeDB(Mssql())
+
+	tests := []TestSqlite{
+		{Id: 3, Foo: "test", Bar: time.Now()},
+		{Id: 4, Foo: "test", Bar: time.Now()},
+	}
+	_, err := DB.BatchInsert(&tests)
+	a.Empty(err)
+
+	last := rec.Last()
+	a.Equal(`INSERT INTO xsql ([id], [foo], [bar]) VALUES (@p1, @p2, @p3), (@p4, @p5, @p6)`, last.SQL)
+	a.Len(last.Args, 6)
+}
+
+func TestMssqlInsertTakeLastId(t *testing.T) {
+	a := assert.New(t)
+
+	DB, rec := newFakeDB(Mssql())
+	rec.Rows = func(query string) ([]string, [][]driver.Value) {
+		return []string{"id"}, [][]driver.Value{{int64(7)}}
+	}
+
+	res, err := DB.InsertTakeLastId(&TestMssql{Foo: "test", Bar: time.Now()}, "")
+	a.Empty(err)
+
+	a.Equal(`INSERT INTO xsql ([foo], [bar]) OUTPUT INSERTED.[id] VALUES (@p1, @p2)`, rec.Last().SQL)
+	id, _ := res.LastInsertId()
+	a.Equal(int64(7), id)
+}
+
+func TestMssqlCondition(t *testing.T) {
+	a := assert.New(t)
+
+	DB, _ := newFakeDB(Mssql())
+
+	cond := DB.NewCondition()
+	cond.Limit(10, 20)
+	a.Equal("order by (select null) offset 10 rows fetch next 20 rows only", cond.Build())
+
+	cond = DB.NewCondition()
+	cond.Order("id", "desc")
+	cond.Limit(10, 20)
+	a.Equal("order by id desc offset 10 rows fetch next 20 rows only", cond.Build())
+}
@@ -0,0 +1,63 @@
+package xsql
+
+import (
+	"database/sql/driver"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type TestPg struct {
+	Id  int       `xsql:"id,omitempty"`
+	Foo string    `xsql:"foo"`
+	Bar time.Time `xsql:"bar"`
+}
+
+func (t TestPg) TableName() string {
+	return "xsql"
+}
+
+func (t TestPg) PrimaryName() string {
+	return "id"
+}
+
+func TestPostgresInsert(t *testing.T) {
+	a := assert.New(t)
+
+	DB, rec := newFakeDB(Postgres())
+
+	now := time.Now()
+	_, err := DB.Insert(&TestPg{Foo: "test", Bar: now})
+	a.Empty(err)
+
+	last := rec.Last()
+	a.Equal(`INSERT INTO xsql ("foo", "bar") VALUES ($1, $2)`, last.SQL)
+	a.Equal([]interface{}{"test", now}, last.Args)
+}
+
+func TestPostgresInsertTakeLastId(t *testing.T) {
+	a := assert.New(t)
+
+	DB, rec := newFakeDB(Postgres())
+	rec.Rows = func(query string) ([]string, [][]driver.Value) {
+		return []string{"id"}, [][]driver.Value{{int64(3)}}
+	}
+
+	res, err := DB.InsertTakeLastId(&TestPg{Foo: "test", Bar: time.Now()}, "")
+	a.Empty(err)
+
+	a.Equal(`INSERT INTO xsql ("foo", "bar") VALUES ($1, $2) RETURNING "id"`, rec.Last().SQL)
+	id, _ := res.LastInsertId()
+	a.Equal(int64(3), id)
+}
+
+func TestPostgresCondition(t *testing.T) {
+	a := assert.New(t)
+
+	DB, _ := newFakeDB(Postgres())
+
+	cond := DB.NewCondition()
+	cond.Order("id", "desc")
+	cond.Limit(10, 20)
+	a.Equal("order by id desc limit 20 offset 10", cond.Build())
+}
@@ -0,0 +1,124 @@
+package xsql
+
+import (
+	ora "github.com/sijms/go-ora/v2"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDialectCondition(t *testing.T) {
+	a := assert.New(t)
+
+	cond := NewCondition(MysqlDialect{})
+	cond.Where("id > ?")
+	cond.Order("id", "desc")
+	cond.Limit(10, 20)
+	a.Equal("where id > ? order by id desc limit 10,20", cond.Build())
+
+	cond = NewCondition(OracleDialect{})
+	cond.Where("ID > :1")
+	cond.Limit(10, 20)
+	a.Equal("where ID > :1  offset 10 rows fetch next 20 rows only", cond.Build())
+
+	// 零值使用 mysql
+	var zero Condition
+	zero.Limit(10, 20)
+	a.Equal(" limit 10,20", zero.Build())
+}
+
+func TestDialectBind(t *testing.T) {
+	a := assert.New(t)
+
+	now := time.Date(2022, 4, 14, 23, 49, 48, 0, time.Local)
+
+	v, bind := MysqlDialect{}.Bind("?", now, DefaultTimeLayout)
+	a.Equal("?", v)
+	a.Equal("2022-04-14 23:49:48", bind)
+
+	v, bind = OracleDialect{}.Bind(":1", now, DefaultTimeLayout)
+	a.Equal("TO_TIMESTAMP(:1, 'SYYYY-MM-DD HH24:MI:SS:FF6')", v)
+	a.Equal("2022-04-14 23:49:48", bind)
+
+	_, bind = OracleDialect{}.Bind(":1", []uint8{}, DefaultTimeLayout)
+	a.Equal("", bind)
+
+	// 超过 VARCHAR2、RAW 长度限制时以 CLOB、BLOB 绑定
+	long := strings.Repeat("a", 4001)
+	_, bind = OracleDialect{}.Bind(":1", long, DefaultTimeLayout)
+	a.Equal(ora.Clob{String: long, Valid: true}, bind)
+	_, bind = OracleDialect{}.Bind(":1", long[:4000], DefaultTimeLayout)
+	a.Equal(long[:4000], bind)
+	_, bind = OracleDialect{}.Bind(":1", []byte(long), DefaultTimeLayout)
+	a.Equal(ora.Blob{Data: []byte(long), Valid: true}, bind)
+}
+
+func TestDialectUpsert(t *testing.T) {
+	a := assert.New(t)
+
+	insert := InsertSQL{
+		Key:     "INSERT INTO",
+		Table:   "xsql",
+		Columns: []string{"`id`", "`foo`"},
+		Values:  [][]string{{"?", "?"}},
+	}
+	a.Equal("INSERT INTO xsql (`id`, `foo`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `foo` = VALUES(`foo`)",
+		MysqlDialect{}.Upsert(insert, []string{"id"}, []string{"foo"}))
+
+	insert = InsertSQL{
+		Key:     "INSERT INTO",
+		Table:   "XSQL",
+		Columns: []string{`"ID"`, `"FOO"`},
+		Values:  [][]string{{":1", ":2"}},
+	}
+	a.Equal(`MERGE INTO XSQL t USING (SELECT :1 "ID", :2 "FOO" FROM DUAL) s ON (t."ID" = s."ID") WHEN MATCHED THEN UPDATE SET t."FOO" = s."FOO" WHEN NOT MATCHED THEN INSERT ("ID", "FOO") VALUES (s."ID", s."FOO")`,
+		OracleDialect{}.Upsert(insert, []string{"ID"}, []string{"FOO"}))
+
+	// oracle 不能更新 ON 中的列
+	a.Equal(`MERGE INTO XSQL t USING (SELECT :1 "ID", :2 "FOO" FROM DUAL) s ON (t."ID" = s."ID") WHEN NOT MATCHED THEN INSERT ("ID", "FOO") VALUES (s."ID", s."FOO")`,
+		OracleDialect{}.Upsert(insert, []string{"ID"}, []string{"ID"}))
+}
+
+func TestDialectUpsertExec(t *testing.T) {
+	a := assert.New(t)
+
+	// mysql 没有更新的列时更新为原值
+	DB, rec := newFakeDB(Options{InsertKey: "REPLACE INTO"})
+	_, err := DB.Upsert(&TestModelComposite{TenantId: "t1", Code: "c1", Name: "foo"}, nil, nil)
+	a.Empty(err)
+	a.Equal("INSERT INTO composite (`tenant_id`, `code`, `name`) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `tenant_id` = `tenant_id`", rec.Last().SQL)
+
+	DB, rec = newFakeDB(Mssql())
+	_, err = DB.BatchUpsert([]TestModelComposite{{TenantId: "t1", Code: "c1", Name: "foo"}, {TenantId: "t1", Code: "c2", Name: "bar"}}, nil, []string{"name"})
+	a.Empty(err)
+	a.Equal("MERGE INTO composite t USING (VALUES (@p1, @p2, @p3), (@p4, @p5, @p6)) AS s ([tenant_id], [code], [name]) ON (t.[tenant_id] = s.[tenant_id] AND t.[code] = s.[code]) WHEN MATCHED THEN UPDATE SET t.[name] = s.[name] WHEN NOT MATCHED THEN INSERT ([tenant_id], [code], [name]) VALUES (s.[tenant_id], s.[code], s.[name]);", rec.Last().SQL)
+	a.Len(rec.Last().Args, 6)
+
+	_, err = DB.Upsert(&TestModelBase{}, nil, nil)
+	a.ErrorContains(err, "upsert requires conflict columns")
+
+	// MERGE 的冲突列需要插入，自增主键为空值时不插入
+	_, err = DB.Upsert(&TestModelTag{Id: 1, Name: "foo"}, nil, []string{"name"})
+	a.Empty(err)
+	a.Equal("MERGE INTO tag t USING (VALUES (@p1, @p2, CURRENT_TIMESTAMP)) AS s ([id], [name], [created]) ON (t.[id] = s.[id]) WHEN MATCHED THEN UPDATE SET t.[name] = s.[name] WHEN NOT MATCHED THEN INSERT ([id], [name], [created]) VALUES (s.[id], s.[name], s.[created]);", rec.Last().SQL)
+	count := len(rec.SQL())
+	_, err = DB.BatchUpsert([]TestModelTag{{Id: 1, Name: "foo"}, {Name: "bar"}}, nil, []string{"name"})
+	a.ErrorContains(err, "conflict column id is not inserted")
+	DB, _ = newFakeDB(Oracle())
+	_, err = DB.Upsert(&TestModelTag{Name: "foo"}, nil, []string{"name"})
+	a.ErrorContains(err, "conflict column id is not inserted")
+	a.Len(rec.SQL(), count)
+
+	// 更新的列需要可以更新
+	DB, rec = newFakeDB()
+	_, err = DB.Upsert(&TestModelTag{Id: 1, Name: "foo"}, nil, []string{"name", "updated"})
+	a.Empty(err)
+	a.Equal("INSERT INTO tag (`id`, `name`, `created`) VALUES (?, ?, CURRENT_TIMESTAMP) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)", rec.Last().SQL)
+	count = len(rec.SQL())
+	for _, c := range []string{"created", "version", "id"} {
+		_, err = DB.Upsert(&TestModelTag{Id: 1, Name: "foo"}, []string{"name"}, []string{c})
+		a.ErrorContains(err, "update column "+c+" cannot be updated")
+	}
+	a.Len(rec.SQL(), count)
+}
@@ -0,0 +1,168 @@
+package xsql
+
+import (
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/sijms/go-ora/v2/network"
+	"regexp"
+	"strconv"
+)
+
+// 分类错误，使用 errors.Is 判断
+// 数据库返回的错误被包装为 *Error，可通过 errors.As 取出驱动的原始错误，如 *mysql.MySQLError
+var (
+	ErrNoRowsAffected      = errors.New("sql: no rows affected")
+	ErrDuplicateKey        = errors.New("sql: duplicate key")
+	ErrForeignKeyViolation = errors.New("sql: foreign key violation")
+	ErrNotNullViolation    = errors.New("sql: not null violation")
+	ErrValueTooLong        = errors.New("sql: value too long")
+	ErrPrimaryKeyZero      = errors.New("sql: primary key value is zero")
+)
+
+// Error 已分类的数据库错误
+type Error struct {
+	// 分类错误，如 ErrDuplicateKey
+	Kind error
+	// 驱动返回的原始错误
+	Err error
+}
+
+func (t *Error) Error() string {
+	return t.Err.Error()
+}
+
+func (t *Error) Unwrap() error {
+	return t.Err
+}
+
+func (t *Error) Is(target error) bool {
+	return target == t.Kind
+}
+
+// wrapError 按方言分类数据库返回的错误，无法分类时原样返回
+func (t *Options) wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	kind := t.dialect().Classify(err)
+	if kind == nil {
+		return err
+	}
+	return &Error{
+		Kind: kind,
+		Err:  err,
+	}
+}
+
+// Classify mysql 错误码
+func (MysqlDialect) Classify(err error) error {
+	var e *mysql.MySQLError
+	if !errors.As(err, &e) {
+		return nil
+	}
+	switch e.Number {
+	case 1062, 1586:
+		return ErrDuplicateKey
+	case 1216, 1217, 1451, 1452:
+		return ErrForeignKeyViolation
+	case 1048, 1364:
+		return ErrNotNullViolation
+	case 1406:
+		return ErrValueTooLong
+	}
+	return nil
+}
+
+// oraCode 错误信息中的 ORA-NNNNN
+var oraCode = regexp.MustCompile(`ORA-(\d{5})`)
+
+// Classify oracle 错误码
+func (OracleDialect) Classify(err error) error {
+	code := 0
+	var e *network.OracleError
+	if errors.As(err, &e) {
+		code = e.ErrCode
+	} else if m := oraCode.FindStringSubmatch(err.Error()); m != nil {
+		// 其他驱动的错误信息同样以错误码开头
+		code, _ = strconv.Atoi(m[1])
+	}
+	switch code {
+	case 1:
+		return ErrDuplicateKey
+	case 2291, 2292:
+		return ErrForeignKeyViolation
+	case 1400, 1407:
+		return ErrNotNullViolation
+	case 1401, 12899:
+		return ErrValueTooLong
+	}
+	return nil
+}
+
+// Classify sql server 错误码
+func (MssqlDialect) Classify(err error) error {
+	var e interface {
+		SQLErrorNumber() int32
+	}
+	if !errors.As(err, &e) {
+		return nil
+	}
+	switch e.SQLErrorNumber() {
+	case 2601, 2627:
+		return ErrDuplicateKey
+	case 547:
+		return ErrForeignKeyViolation
+	case 515:
+		return ErrNotNullViolation
+	case 2628, 8152:
+		return ErrValueTooLong
+	}
+	return nil
+}
+
+// Classify postgresql SQLSTATE
+func (PostgresDialect) Classify(err error) error {
+	var e interface {
+		SQLState() string
+	}
+	if !errors.As(err, &e) {
+		return nil
+	}
+	switch e.SQLState() {
+	case "23505":
+		return ErrDuplicateKey
+	case "23503":
+		return ErrForeignKeyViolation
+	case "23502":
+		return ErrNotNullViolation
+	case "22001":
+		return ErrValueTooLong
+	}
+	return nil
+}
+
+// Classify sqlite 扩展错误码，sqlite 不限制字段长度
+func (SqliteDialect) Classify(err error) error {
+	var e interface {
+		Code() int
+	}
+	if !errors.As(err, &e) {
+		return nil
+	}
+	switch e.Code() {
+	// SQLITE_CONSTRAINT_PRIMARYKEY、SQLITE_CONSTRAINT_UNIQUE
+	case 1555, 2067:
+		return ErrDuplicateKey
+	// SQLITE_CONSTRAINT_FOREIGNKEY
+	case 787:
+		return ErrForeignKeyViolation
+	// SQLITE_CONSTRAINT_NOTNULL
+	case 1299:
+		return ErrNotNullViolation
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package xsql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/sijms/go-ora/v2/network"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestDialectClassify(t *testing.T) {
+	a := assert.New(t)
+
+	cases := []struct {
+		dialect Dialect
+		err     error
+		kind    error
+	}{
+		{MysqlDialect{}, &mysql.MySQLError{Number: 1062}, ErrDuplicateKey},
+		{MysqlDialect{}, &mysql.MySQLError{Number: 1452}, ErrForeignKeyViolation},
+		{MysqlDialect{}, &mysql.MySQLError{Number: 1451}, ErrForeignKeyViolation},
+		{MysqlDialect{}, &mysql.MySQLError{Number: 1048}, ErrNotNullViolation},
+		{MysqlDialect{}, &mysql.MySQLError{Number: 1406}, ErrValueTooLong},
+		{MysqlDialect{}, &mysql.MySQLError{Number: 1213}, nil},
+		{OracleDialect{}, &network.OracleError{ErrCode: 1}, ErrDuplicateKey},
+		{OracleDialect{}, &network.OracleError{ErrCode: 2291}, ErrForeignKeyViolation},
+		{OracleDialect{}, &network.OracleError{ErrCode: 1400}, ErrNotNullViolation},
+		{OracleDialect{}, &network.OracleError{ErrCode: 12899}, ErrValueTooLong},
+		{OracleDialect{}, errors.New("ORA-00001: unique constraint (XSQL.PK) violated"), ErrDuplicateKey},
+		{OracleDialect{}, errors.New("ORA-00060: deadlock detected"), nil},
+		{MssqlDialect{}, mssqlError(2627), ErrDuplicateKey},
+		{MssqlDialect{}, mssqlError(547), ErrForeignKeyViolation},
+		{MssqlDialect{}, mssqlError(515), ErrNotNullViolation},
+		{MssqlDialect{}, mssqlError(8152), ErrValueTooLong},
+		{PostgresDialect{}, sqlStateError("23505"), ErrDuplicateKey},
+		{PostgresDialect{}, sqlStateError("23503"), ErrForeignKeyViolation},
+		{PostgresDialect{}, sqlStateError("23502"), ErrNotNullViolation},
+		{PostgresDialect{}, sqlStateError("22001"), ErrValueTooLong},
+		{SqliteDialect{}, sqliteError(1555), ErrDuplicateKey},
+		{SqliteDialect{}, sqliteError(787), ErrForeignKeyViolation},
+		{SqliteDialect{}, sqliteError(1299), ErrNotNullViolation},
+		{SqliteDialect{}, sqliteError(5), nil},
+	}
+	for _, c := range cases {
+		a.Equal(c.kind, c.dialect.Classify(c.err), "%s %v", c.dialect.Name(), c.err)
+	}
+}
+
+func TestErrorWrap(t *testing.T) {
+	a := assert.New(t)
+
+	DB, rec := newFakeDB()
+	duplicate := &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"}
+	rec.Err = func(query string) error {
+		if query == "BEGIN" || query == "ROLLBACK" {
+			return nil
+		}
+		return duplicate
+	}
+
+	_, err := DB.Exec("INSERT INTO xsql (id) VALUES (?)", 1)
+	a.ErrorIs(err, ErrDuplicateKey)
+	a.False(errors.Is(err, ErrForeignKeyViolation))
+	var mysqlErr *mysql.MySQLError
+	a.True(errors.As(err, &mysqlErr))
+	a.Equal(uint16(1062), mysqlErr.Number)
+	a.Equal(duplicate.Error(), err.Error())
+
+	_, err = DB.Query("SELECT * FROM xsql")
+	a.ErrorIs(err, ErrDuplicateKey)
+
+	tx, err := DB.Begin()
+	a.Empty(err)
+	_, err = tx.Exec("INSERT INTO xsql (id) VALUES (?)", 1)
+	a.ErrorIs(err, ErrDuplicateKey)
+	a.Empty(tx.Rollback())
+
+	// 无法分类的错误原样返回
+	unknown := &mysql.MySQLError{Number: 1146}
+	rec.Err = func(query string) error {
+		return unknown
+	}
+	_, err = DB.Exec("DELETE FROM xsql")
+	a.Equal(unknown, err)
+}
+
+func TestErrNoRowsAffected(t *testing.T) {
+	a := assert.New(t)
+
+	DB, rec := newFakeDB()
+	rec.Result = driver.RowsAffected(0)
+
+	err := DB.UpdateRes(&TestSqlite{Foo: "foo"}, "id = ?", 1)
+	a.ErrorIs(err, ErrNoRowsAffected)
+
+	err = DB.DeleteByPrimaryRes(TestSqlite{}, 1)
+	a.ErrorIs(err, ErrNoRowsAffected)
+
+	rec.Result = driver.RowsAffected(1)
+	err = DB.UpdateRes(&TestSqlite{Foo: "foo"}, "id = ?", 1)
+	a.Empty(err)
+}
+
+func TestErrPrimaryKeyZero(t *testing.T) {
+	a := assert.New(t)
+
+	DB, _ := newFakeDB()
+	_, err := DB.Save(&TestSqlite{Foo: "foo"}, false, nil)
+	a.ErrorIs(err, ErrPrimaryKeyZero)
+}
+
+func TestSqliteDuplicateKey(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	_, err := DB.Insert(&TestSqlite{Id: 1, Foo: "foo", Bar: time.Now()})
+	a.ErrorIs(err, ErrDuplicateKey)
+	var e *Error
+	a.True(errors.As(err, &e))
+	a.Equal(ErrDuplicateKey, e.Kind)
+	a.Contains(e.Err.Error(), "UNIQUE constraint failed")
+}
@@ -1,6 +1,7 @@
 package xsql
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -11,160 +12,63 @@ import (
 
 type Table interface {
 	TableName() string
-	DBType() string
 }
 type TableAttribute interface {
 	Table
 	PrimaryName() string //获取主键
 }
 
+// CompositePrimary 复合主键，按顺序返回主键的列名
+type CompositePrimary interface {
+	PrimaryNames() []string
+}
+
 type executor struct {
 	Executor
 }
 
-func (t *executor) Insert(data interface{}, opts *Options) (sql.Result, error) {
-	insertKey := "INSERT INTO"
-	if opts.InsertKey != "" {
-		insertKey = opts.InsertKey
-	}
-	placeholder := "?"
-	if opts.Placeholder != "" {
-		placeholder = opts.Placeholder
-	}
-	timeLayout := DefaultTimeLayout
-	if opts.TimeLayout != "" {
-		timeLayout = opts.TimeLayout
-	}
-	timeFunc := DefaultTimeFunc
-	if opts.TimeFunc != nil {
-		timeFunc = opts.TimeFunc
-	}
-	columnQuotes := "`"
-	if opts.ColumnQuotes != "" {
-		columnQuotes = opts.ColumnQuotes
-	}
-	var debugFunc DebugFunc
-	if opts.DebugFunc != nil {
-		debugFunc = opts.DebugFunc
-	}
-
-	fields := make([]string, 0)
-	vars := make([]string, 0)
-	bindArgs := make([]interface{}, 0)
-	var bindArgsPrint string //打印sql插入值得字符串
-
-	table := ""
-
-	value := SqlNull{
-		reflect.ValueOf(data),
-	}
-	switch value.Kind() {
-	case reflect.Ptr:
-		return t.Insert(value.Elem().Interface(), opts)
-	case reflect.Struct:
-		if tab, ok := data.(Table); ok {
-			table = tab.TableName()
-		} else {
-			table = value.Type().Name()
-		}
-		param := 0
-		for i := 0; i < value.NumField(); i++ {
-			if !value.Field(i).CanInterface() {
-				continue
-			}
-			fieldTypeStr := value.FieldTypeBasic(i)
-			//fieldTypeStr := value.Field(i).Type().String()
+// conn 将 *sql.Conn 作为 Executor、Query 使用，用于需要在同一个连接中执行的多条语句
+type conn struct {
+	*sql.Conn
+}
 
-			isTime := value.Field(i).Type().String() == "time.Time"
+func (t conn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.ExecContext(context.Background(), query, args...)
+}
 
-			tag := value.Type().Field(i).Tag.Get("xsql")
-			if tag == "" || tag == "-" || tag == "_" {
-				continue
-			}
-			strs := strings.Split(tag, ",")
-			//是否空值忽略该字段
-			var omitempy bool
-			if len(strs) > 1 {
-				for _, s := range strs[1:] {
-					if strings.Contains(s, "omitempty") {
-						omitempy = true
-					}
-				}
-			}
+func (t conn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return t.QueryContext(context.Background(), query, args...)
+}
 
-			valueFieldVal := ""
-			valBasic := value.FieldAnyBasic(i)
-			if fieldTypeStr == "string" {
-				valueFieldVal = fmt.Sprintf("%s", valBasic)
-			} else if fieldTypeStr == "int" || fieldTypeStr == "int64" || fieldTypeStr == "int32" {
-				valueFieldVal = fmt.Sprintf("%d", valBasic)
-			} else if fieldTypeStr == "[]uint8" {
-				blobInsertRealVal := valBasic.([]uint8)
-				if len(blobInsertRealVal) == 0 {
-					valueFieldVal = "0"
-				}
-			} else {
-				valueFieldVal = "OTHER_DATA"
-			}
+// execContext 执行语句，不在事务中时按 opts.Retry 重试临时错误，返回的错误按方言分类
+func (t *executor) execContext(ctx context.Context, query string, args []interface{}, opts *Options) (sql.Result, error) {
+	if _, ok := t.Executor.(*sql.Tx); ok {
+		res, err := t.Executor.ExecContext(ctx, query, args...)
+		return res, opts.wrapError(err)
+	}
+	var res sql.Result
+	err := opts.retry(ctx, Log{SQL: query, Bindings: args}, func() (err error) {
+		res, err = t.Executor.ExecContext(ctx, query, args...)
+		return err
+	})
+	return res, opts.wrapError(err)
+}
 
-			//fmt.Println(value.Field(i).Type().String(),value.Field(i).Interface(),valueFieldVal)
-			if omitempy && (valueFieldVal == "" || valueFieldVal == "0") {
-				continue
-			} else {
-				fields = append(fields, strs[0])
-				v := ""
-				param++
-				if placeholder == "?" {
-					v = placeholder
-				} else if placeholder == "@" {
-					v = fmt.Sprintf("@p%d", param)
-				} else {
-					v = fmt.Sprintf(placeholder, i)
-				}
-				if isTime {
-					vars = append(vars, timeFunc(v))
-				} else {
-					vars = append(vars, v)
-				}
-
-				if isTime {
-					ti := value.Field(i).Interface().(time.Time)
-					insertRealVal := ti.Format(timeLayout)
-					bindArgsPrint += fmt.Sprintf("%s, ", insertRealVal)
-					bindArgs = append(bindArgs, insertRealVal)
-				} else {
-					insertRealVal := value.FieldAnyBasic(i)
-					if fieldTypeStr == "string" {
-						bindArgsPrint += fmt.Sprintf("'%v', ", insertRealVal)
-					} else if fieldTypeStr == "[]uint8" {
-						blobInsertRealVal := insertRealVal.([]uint8)
-						if len(blobInsertRealVal) > 0 {
-							bindArgsPrint += fmt.Sprintf("'%v', ", string(blobInsertRealVal))
-						} else {
-							bindArgsPrint += "'', "
-							if dataTable, _ := data.(Table); dataTable.DBType() == "Oracle" {
-								insertRealVal = any("")
-							}
-						}
-					} else {
-						bindArgsPrint += fmt.Sprintf("%v, ", insertRealVal)
-					}
-
-					bindArgs = append(bindArgs, insertRealVal)
-				}
-			}
+func (t *executor) Insert(ctx context.Context, data interface{}, opts *Options) (sql.Result, error) {
+	var debugFunc DebugFunc
+	if opts.DebugFunc != nil {
+		debugFunc = opts.DebugFunc
+	}
 
-		}
-		break
-	default:
-		return nil, errors.New("sql: only for struct type")
+	insert, bindArgs, bindArgsPrint, err := t.parseInsert(data, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	SQL := fmt.Sprintf(`%s %s (%s) VALUES (%s)`, insertKey, table, columnQuotes+strings.Join(fields, columnQuotes+", "+columnQuotes)+columnQuotes, strings.Join(vars, `, `))
-	bindArgsPrint = strings.TrimSuffix(bindArgsPrint, ", ")
-	SQLPrint := fmt.Sprintf(`%s %s (%s) VALUES (%s)`, insertKey, table, columnQuotes+strings.Join(fields, columnQuotes+", "+columnQuotes)+columnQuotes, bindArgsPrint)
+	SQL := insert.String()
+	SQLPrint := fmt.Sprintf(`%s %s (%s) VALUES (%s)`, insert.Key, insert.Table, strings.Join(insert.Columns, ", "), bindArgsPrint)
 	startTime := time.Now()
-	res, err := t.Executor.Exec(SQL, bindArgs...)
+	res, err := t.execContext(ctx, SQL, bindArgs, opts)
 	var rowsAffected int64
 	if res != nil {
 		rowsAffected, _ = res.RowsAffected()
@@ -187,165 +91,142 @@ func (t *executor) Insert(data interface{}, opts *Options) (sql.Result, error) {
 	return res, nil
 }
 
-func (t *executor) InsertTakeLastId(data interface{}, withSeq string, query query, opts *Options) (sql.Result, error) {
+/*
+@Description: 解析结构体为插入语句
+@receiver t
+@param data
+@param opts
+@return InsertSQL
+@return []interface{} 绑定参数
+@return string 打印sql插入值得字符串
+@return error
+*/
+func (t *executor) parseInsert(data interface{}, opts *Options) (InsertSQL, []interface{}, string, error) {
 	insertKey := "INSERT INTO"
 	if opts.InsertKey != "" {
 		insertKey = opts.InsertKey
 	}
-	placeholder := "?"
-	if opts.Placeholder != "" {
-		placeholder = opts.Placeholder
-	}
-	timeLayout := DefaultTimeLayout
-	if opts.TimeLayout != "" {
-		timeLayout = opts.TimeLayout
-	}
-	timeFunc := DefaultTimeFunc
-	if opts.TimeFunc != nil {
-		timeFunc = opts.TimeFunc
-	}
-	columnQuotes := "`"
-	if opts.ColumnQuotes != "" {
-		columnQuotes = opts.ColumnQuotes
-	}
-	var debugFunc DebugFunc
-	if opts.DebugFunc != nil {
-		debugFunc = opts.DebugFunc
-	}
+	dialect := opts.dialect()
+	ph := newPlaceholders(dialect)
+	timeLayout := opts.timeLayout()
 
 	fields := make([]string, 0)
 	vars := make([]string, 0)
 	bindArgs := make([]interface{}, 0)
+	var bindArgsPrint string //打印sql插入值得字符串
 
-	table := ""
-
-	value := SqlNull{
-		reflect.ValueOf(data),
-	}
+	value := reflect.ValueOf(data)
 	switch value.Kind() {
 	case reflect.Ptr:
-		return t.Insert(value.Elem().Interface(), opts)
+		return t.parseInsert(value.Elem().Interface(), opts)
 	case reflect.Struct:
+		break
+	default:
+		return InsertSQL{}, nil, "", errors.New("sql: only for struct type")
+	}
+	m, err := modelOf(value.Type())
+	if err != nil {
+		return InsertSQL{}, nil, "", err
+	}
+	table := m.tableName(data)
 
-		if tab, ok := data.(Table); ok {
-			table = tab.TableName()
-		} else {
-			table = value.Type().Name()
+	for _, f := range m.fields {
+		fieldValue := value.Field(f.index[0])
+		if !f.insertable() || f.insertSkip(fieldValue) {
+			continue
+		}
+		fields = append(fields, dialect.Quote(f.column))
+		if f.insertDefault(fieldValue) {
+			vars = append(vars, f.def)
+			bindArgsPrint += f.def + ", "
+			continue
 		}
-		paramNum := 0
-		for i := 0; i < value.NumField(); i++ {
-			if !value.Field(i).CanInterface() {
-				continue
-			}
-			fieldTypeStr := value.Field(i).Type().String()
-
-			isTime := value.Field(i).Type().String() == "time.Time"
 
-			tag := value.Type().Field(i).Tag.Get("xsql")
-			if tag == "" || tag == "-" || tag == "_" {
-				continue
-			}
-			strs := strings.Split(tag, ",")
-			//是否空值忽略该字段
-			var omitempy bool
-			if len(strs) > 1 {
-				for _, s := range strs[1:] {
-					if strings.Contains(s, "omitempty") {
-						omitempy = true
-					}
-				}
-			}
+		valBasic := f.basic(fieldValue)
+		v, insertRealVal := dialect.Bind(ph.next(), valBasic, timeLayout)
+		vars = append(vars, f.placeholder(v))
+		bindArgs = append(bindArgs, insertRealVal)
+
+		switch val := valBasic.(type) {
+		case string:
+			bindArgsPrint += fmt.Sprintf("'%v', ", val)
+		case []uint8:
+			bindArgsPrint += fmt.Sprintf("'%s', ", string(val))
+		case time.Time:
+			bindArgsPrint += fmt.Sprintf("%s, ", val.Format(timeLayout))
+		default:
+			bindArgsPrint += fmt.Sprintf("%v, ", val)
+		}
+	}
 
-			valueFieldVal := ""
-			valBasic := value.FieldAnyBasic(i)
-			if fieldTypeStr == "string" {
-				valueFieldVal = fmt.Sprintf("%s", valBasic)
-			} else if fieldTypeStr == "int" || fieldTypeStr == "int64" || fieldTypeStr == "int32" {
-				valueFieldVal = fmt.Sprintf("%d", valBasic)
-			}
+	insert := InsertSQL{
+		Key:     insertKey,
+		Table:   table,
+		Columns: fields,
+		Values:  [][]string{vars},
+	}
+	return insert, bindArgs, strings.TrimSuffix(bindArgsPrint, ", "), nil
+}
 
-			//fmt.Println(value.Field(i).Type().String(),value.Field(i).Interface(),valueFieldVal)
-			if omitempy && (valueFieldVal == "" || valueFieldVal == "0") {
-				continue
-			} else {
-				fields = append(fields, strs[0])
-				v := ""
-				paramNum++
-				if placeholder == "?" {
-					v = placeholder
-				} else if placeholder == "@" {
-					v = fmt.Sprintf("@p%d", paramNum)
-				} else {
-					v = fmt.Sprintf(placeholder, i)
-				}
-				if isTime {
-					vars = append(vars, timeFunc(v))
-				} else {
-					vars = append(vars, v)
-				}
-
-				if isTime {
-					ti := value.Field(i).Interface().(time.Time)
-					bindArgs = append(bindArgs, ti.Format(timeLayout))
-				} else {
-					bindArgs = append(bindArgs, value.Field(i).Interface())
-				}
-			}
+func (t *executor) InsertTakeLastId(ctx context.Context, data interface{}, withSeq string, query query, opts *Options) (sql.Result, error) {
+	var debugFunc DebugFunc
+	if opts.DebugFunc != nil {
+		debugFunc = opts.DebugFunc
+	}
 
-		}
-		break
-	default:
-		return nil, errors.New("sql: only for struct type")
+	insert, bindArgs, _, err := t.parseInsert(data, opts)
+	if err != nil {
+		return nil, err
+	}
+	primary := ""
+	if m, err := modelOf(reflect.Indirect(reflect.ValueOf(data)).Type()); err == nil {
+		primary = m.lastIdColumn(data)
 	}
+	strategy, lastIdSQL := opts.dialect().LastInsertId(insert, primary, withSeq)
 
-	SQL := fmt.Sprintf(`%s %s (%s) VALUES (%s)`, insertKey, table, columnQuotes+strings.Join(fields, columnQuotes+", "+columnQuotes)+columnQuotes, strings.Join(vars, `, `))
+	SQL := insert.String()
 	startTime := time.Now()
 	var res QueryRes
-	var err error
-	var rowsAffected int64
-	dataTable, _ := data.(Table)
-	switch dataTable.DBType() {
-	case "Mssql":
-		SQL += ";Select SCOPE_IDENTITY() INSERT_ID"
-		f, err := query.Fetch(SQL, bindArgs, opts)
-		if err != nil {
-			return nil, err
-		}
-		defer f.R.Close()
-		// Fetch rows
-		var lastId int64
-
-		for f.R.Next() {
-			if err = f.R.Scan(&lastId); err != nil {
-				return nil, err
+	switch strategy {
+	case LastIdReturning:
+		SQL = lastIdSQL
+		res.InsertId, err = t.fetchLastId(ctx, query, SQL, bindArgs, opts)
+		res.Affected = 1
+		break
+	case LastIdFollow:
+		// CURRVAL 等查询只在插入的会话中有效，不在事务中时两条语句使用同一个连接
+		exec, q := t, query
+		if db, ok := t.Executor.(*sql.DB); ok {
+			var c *sql.Conn
+			if c, err = db.Conn(ctx); err != nil {
+				err = opts.wrapError(err)
+				break
 			}
+			defer c.Close()
+			exec, q.Query = &executor{Executor: conn{c}}, conn{c}
 		}
-		//获取insert执行的时候是否错误
-		if err := f.R.Err(); err != nil {
-			return nil, err
-		}
-		res = QueryRes{
-			InsertId: lastId,
-			Affected: 1,
+		_, err = exec.execContext(ctx, SQL, bindArgs, opts)
+		if err != nil {
+			break
 		}
+		res.InsertId, err = exec.fetchLastId(ctx, q, lastIdSQL, nil, opts)
+		res.Affected = 1
 		break
-	case "Oracle":
-		_, err = t.Executor.Exec(SQL, bindArgs...)
+	default:
+		var r sql.Result
+		r, err = t.execContext(ctx, SQL, bindArgs, opts)
 		if err != nil {
-			return res, err
+			break
 		}
-		res = QueryRes{
-			InsertId: 0,
-			Affected: 1,
-		}
-		break
+		res.InsertId, _ = r.LastInsertId()
+		res.Affected, _ = r.RowsAffected()
 	}
 
 	l := &Log{
 		Time:         time.Now().Sub(startTime),
 		SQL:          SQL,
 		Bindings:     bindArgs,
-		RowsAffected: rowsAffected,
+		RowsAffected: res.Affected,
 		Error:        err,
 	}
 	if debugFunc != nil {
@@ -358,157 +239,130 @@ func (t *executor) InsertTakeLastId(data interface{}, withSeq string, query quer
 	return res, nil
 }
 
-func (t *executor) BatchInsert(array interface{}, opts *Options) (sql.Result, error) {
-	insertKey := "INSERT INTO"
-	if opts.InsertKey != "" {
-		insertKey = opts.InsertKey
-	}
-	placeholder := "?"
-	if opts.Placeholder != "" {
-		placeholder = opts.Placeholder
+// fetchLastId 查询自增ID
+func (t *executor) fetchLastId(ctx context.Context, query query, SQL string, args []interface{}, opts *Options) (int64, error) {
+	f, err := query.Fetch(ctx, SQL, args, opts)
+	if err != nil {
+		return 0, err
 	}
-	timeLayout := DefaultTimeLayout
-	if opts.TimeLayout != "" {
-		timeLayout = opts.TimeLayout
+	defer f.R.Close()
+
+	var lastId int64
+	for f.R.Next() {
+		if err = f.R.Scan(&lastId); err != nil {
+			return 0, err
+		}
 	}
-	columnQuotes := "`"
-	if opts.ColumnQuotes != "" {
-		columnQuotes = opts.ColumnQuotes
+	//获取insert执行的时候是否错误
+	if err := f.R.Err(); err != nil {
+		return 0, err
 	}
-	var debugFunc DebugFunc
-	if opts.DebugFunc != nil {
-		debugFunc = opts.DebugFunc
-	}
-
-	fields := make([]string, 0)
-	valueSql := make([]string, 0)
-	bindArgs := make([]interface{}, 0)
-
-	table := ""
+	return lastId, nil
+}
 
-	// check
-	value := reflect.ValueOf(array)
-	switch value.Kind() {
-	case reflect.Ptr:
-		return t.BatchInsert(value.Elem().Interface(), opts)
-	case reflect.Array, reflect.Slice:
-		break
-	default:
-		return nil, errors.New("sql: only for struct array/slice type")
-	}
-	if value.Len() == 0 {
-		return nil, errors.New("sql: array/slice length cannot be 0")
+func (t *executor) BatchInsert(ctx context.Context, array interface{}, opts *Options) (sql.Result, error) {
+	rows, m, err := batchRows(array)
+	if err != nil {
+		return nil, err
 	}
+	return t.batchInsert(ctx, rows, m, m.batchStatements(rows, opts), nil, opts)
+}
 
-	// fields
-	switch value.Index(0).Kind() {
-	case reflect.Struct:
-		subValue := value.Index(0)
+/*
+@Description: 插入，主键或唯一键冲突时更新，插入的字段与 Insert 一致
+@receiver t
+@param ctx
+@param data 结构体或结构体数组/切片
+@param conflict 冲突判断的列名，为空时使用主键
+@param update 冲突时更新的列名，必须是可写入的字段，冲突列及 omitempty 的空值不会更新，为空时不更新
+@param opts
+@return sql.Result
+@return error
+*/
+func (t *executor) Upsert(ctx context.Context, data interface{}, conflict []string, update []string, opts *Options) (sql.Result, error) {
+	value := reflect.Indirect(reflect.ValueOf(data))
+	if value.Kind() == reflect.Struct {
+		// 单条数据同样按多行插入处理
+		rows := reflect.New(reflect.SliceOf(value.Type())).Elem()
+		value = reflect.Append(rows, value)
+	} else if value.Kind() != reflect.Array && value.Kind() != reflect.Slice {
+		return nil, errors.New("sql: only for struct or struct array/slice type")
+	}
+	rows, m, err := batchRows(value.Interface())
+	if err != nil {
+		return nil, err
+	}
 
-		if tab, ok := subValue.Interface().(Table); ok {
-			table = tab.TableName()
-		} else {
-			table = subValue.Type().Name()
+	if len(conflict) == 0 {
+		for _, f := range m.primary(rows.Index(0).Interface()) {
+			conflict = append(conflict, f.column)
 		}
-
-		for i := 0; i < subValue.NumField(); i++ {
-			if !subValue.Field(i).CanInterface() {
-				continue
-			}
-			tag := subValue.Type().Field(i).Tag.Get("xsql")
-			if tag == "" || tag == "-" || tag == "_" {
-				continue
-			}
-			fields = append(fields, tag)
+	}
+	if len(conflict) == 0 {
+		return nil, errors.New("sql: upsert requires conflict columns or a primary key")
+	}
+	for _, c := range update {
+		if f := m.field(c); f == nil || !f.updatable() {
+			return nil, fmt.Errorf("sql: update column %s cannot be updated", c)
 		}
-		break
-	default:
-		return nil, errors.New("sql: only for struct array/slice type")
 	}
 
-	// values
-	switch value.Kind() {
-	case reflect.Slice, reflect.Array:
-		ai := 0
-		for r := 0; r < value.Len(); r++ {
-			switch value.Index(r).Kind() {
-			case reflect.Struct:
-				subValue := value.Index(r)
-				vars := make([]string, 0)
-				for c := 0; c < subValue.NumField(); c++ {
-					if !subValue.Field(c).CanInterface() {
-						continue
-					}
-
-					tag := subValue.Type().Field(c).Tag.Get("xsql")
-					if tag == "" || tag == "-" || tag == "_" {
-						continue
-					}
-
-					if placeholder == "?" {
-						vars = append(vars, placeholder)
-					} else {
-						vars = append(vars, fmt.Sprintf(placeholder, ai))
-						ai += 1
-					}
-
-					// time特殊处理
-					if subValue.Field(c).Type().String() == "time.Time" {
-						ti := subValue.Field(c).Interface().(time.Time)
-						bindArgs = append(bindArgs, ti.Format(timeLayout))
-					} else {
-						bindArgs = append(bindArgs, subValue.Field(c).Interface())
-					}
-				}
-				valueSql = append(valueSql, fmt.Sprintf("(%s)", strings.Join(vars, `, `)))
-				break
-			default:
-				return nil, errors.New("sql: only for struct array/slice type")
+	// 冲突列需要插入，MERGE 按插入的数据匹配，omitempty、autoincr 的空值无法用于判断冲突
+	statements := m.batchStatements(rows, opts)
+	for _, s := range statements {
+		for _, c := range conflict {
+			if !containsColumn(s.columns, c) {
+				return nil, fmt.Errorf("sql: conflict column %s is not inserted", c)
 			}
 		}
-		break
-	default:
-		return nil, errors.New("sql: only for struct array/slice type")
 	}
 
-	SQL := fmt.Sprintf(`%s %s (%s) VALUES %s`, insertKey, table, columnQuotes+strings.Join(fields, columnQuotes+", "+columnQuotes)+columnQuotes, strings.Join(valueSql, ", "))
+	dialect := opts.dialect()
+	return t.batchInsert(ctx, rows, m, statements, func(insert InsertSQL, columns []*field) string {
+		// REPLACE INTO 等自定义的插入关键字不能与冲突更新同时使用
+		insert.Key = "INSERT INTO"
+		return dialect.Upsert(insert, conflict, upsertColumns(columns, conflict, update))
+	}, opts)
+}
 
-	startTime := time.Now()
-	res, err := t.Executor.Exec(SQL, bindArgs...)
-	var rowsAffected int64
-	if res != nil {
-		rowsAffected, _ = res.RowsAffected()
-	}
-	l := &Log{
-		Time:         time.Now().Sub(startTime),
-		SQL:          SQL,
-		Bindings:     bindArgs,
-		RowsAffected: rowsAffected,
-		Error:        err,
-	}
-	if debugFunc != nil {
-		debugFunc(l)
-	}
-	if err != nil {
-		return nil, err
+/*
+@Description: 冲突时更新的列：去掉冲突列及本条语句未插入的列
+未插入的列为 omitempty 的空值，与 Update 一致不更新，且 mysql 会更新为默认值、MERGE 找不到数据源的列
+@param columns 插入的字段
+@param conflict
+@param update
+@return []string
+*/
+func upsertColumns(columns []*field, conflict []string, update []string) []string {
+	inserted := make(map[string]bool, len(columns))
+	for _, f := range columns {
+		inserted[f.column] = true
+	}
+	for _, c := range conflict {
+		delete(inserted, c)
+	}
+	result := make([]string, 0, len(update))
+	for _, c := range update {
+		if inserted[c] {
+			result = append(result, c)
+		}
 	}
-
-	return res, nil
+	return result
 }
 
-func (t *executor) UpdateForce(data interface{}, expr string, fields []string, opts *Options) (sql.Result, error) {
-	placeholder := "?"
-	if opts.Placeholder != "" {
-		placeholder = opts.Placeholder
-	}
-	timeLayout := DefaultTimeLayout
-	if opts.TimeLayout != "" {
-		timeLayout = opts.TimeLayout
-	}
-	columnQuotes := "`"
-	if opts.ColumnQuotes != "" {
-		columnQuotes = opts.ColumnQuotes
+func containsColumn(fields []*field, column string) bool {
+	for _, f := range fields {
+		if f.column == column {
+			return true
+		}
 	}
+	return false
+}
+
+func (t *executor) UpdateForce(ctx context.Context, data interface{}, expr string, fields []string, opts *Options) (sql.Result, error) {
+	dialect := opts.dialect()
+	ph := newPlaceholders(dialect)
+	timeLayout := opts.timeLayout()
 	var debugFunc DebugFunc
 	if opts.DebugFunc != nil {
 		debugFunc = opts.DebugFunc
@@ -517,87 +371,44 @@ func (t *executor) UpdateForce(data interface{}, expr string, fields []string, o
 	set := make([]string, 0)
 	bindArgs := make([]interface{}, 0)
 
-	table := ""
-
-	typeVal := reflect.TypeOf(data)
 	value := reflect.ValueOf(data)
 	switch value.Kind() {
 	case reflect.Ptr:
-		return t.UpdateForce(value.Elem().Interface(), expr, fields, opts)
+		return t.UpdateForce(ctx, value.Elem().Interface(), expr, fields, opts)
 	case reflect.Struct:
-		if tab, ok := data.(Table); ok {
-			table = tab.TableName()
-		} else {
-			table = value.Type().Name()
-		}
-		paramNum := 0 //真正需要更新得字段数量
-		for i := 0; i < value.NumField(); i++ {
-			//类型
-			fieldTypeStr := value.Field(i).Type().String()
-			//属性名称
-			fieldName := typeVal.Field(i).Name
-			hasForce := false //是否是强制更新的字段
-			if !value.Field(i).CanInterface() {
-				continue
-			}
-
-			tag := value.Type().Field(i).Tag.Get("xsql")
-			if tag == "" || tag == "-" || tag == "_" {
-				continue
-			}
-
-			strs := strings.Split(tag, ",")
-			//是否空值忽略该字段
-			var omitempy bool
-			if len(strs) > 1 {
-				for _, s := range strs[1:] {
-					if strings.Contains(s, "omitempty") {
-						omitempy = true
-					}
-				}
-			}
-
-			valueFieldVal := ""
-			if fieldTypeStr == "string" {
-				valueFieldVal = fmt.Sprintf("%s", value.Field(i).Interface())
-			} else if fieldTypeStr == "int" || fieldTypeStr == "int64" || fieldTypeStr == "int32" {
-				valueFieldVal = fmt.Sprintf("%d", value.Field(i).Interface())
-			}
-			for _, field := range fields {
-				if field == fieldName {
-					hasForce = true
-				}
-			}
-			//fmt.Println(value.Field(i).Type().String(),value.Field(i).Interface(),valueFieldVal)
-			if omitempy && (valueFieldVal == "" || valueFieldVal == "0") && !hasForce {
-				continue
-			} else {
-				paramNum++
-				tag = strs[0]
-				if placeholder == "?" {
-					set = append(set, fmt.Sprintf("%s = %s", columnQuotes+tag+columnQuotes, placeholder))
-				} else if placeholder == "@" {
-					set = append(set, fmt.Sprintf("%s = @p%d", columnQuotes+tag+columnQuotes, paramNum))
-				} else {
-					set = append(set, fmt.Sprintf("%s = %s", columnQuotes+tag+columnQuotes, fmt.Sprintf(placeholder, i)))
-				}
-				// time特殊处理
-				if value.Field(i).Type().String() == "time.Time" {
-					ti := value.Field(i).Interface().(time.Time)
-					bindArgs = append(bindArgs, ti.Format(timeLayout))
-				} else {
-					bindArgs = append(bindArgs, value.Field(i).Interface())
-				}
-			}
-
-		}
 		break
 	default:
 		return nil, errors.New("sql: only for struct type")
 	}
+	m, err := modelOf(value.Type())
+	if err != nil {
+		return nil, err
+	}
+	table := m.tableName(data)
+
+	for _, f := range m.fields {
+		fieldValue := value.Field(f.index[0])
+		//是否是强制更新的字段
+		hasForce := false
+		for _, field := range fields {
+			if field == f.name {
+				hasForce = true
+			}
+		}
+		if !f.updatable() || f.omitempty && f.isEmpty(fieldValue) && !hasForce {
+			continue
+		}
+		v, bindVal := dialect.Bind(ph.next(), fieldValue.Interface(), timeLayout)
+		set = append(set, fmt.Sprintf("%s = %s", dialect.Quote(f.column), f.placeholder(v)))
+		bindArgs = append(bindArgs, bindVal)
+	}
 
 	where := ""
 	if expr != "" {
+		expr, _, err := ph.bind(expr, nil, opts.RewritePlaceholder)
+		if err != nil {
+			return nil, err
+		}
 		where = fmt.Sprintf(` WHERE %s`, expr)
 		//bindArgs = append(bindArgs, args...)
 	}
@@ -605,7 +416,7 @@ func (t *executor) UpdateForce(data interface{}, expr string, fields []string, o
 	SQL := fmt.Sprintf(`UPDATE %s SET %s%s`, table, strings.Join(set, ", "), where)
 
 	startTime := time.Now()
-	res, err := t.Executor.Exec(SQL, bindArgs...)
+	res, err := t.execContext(ctx, SQL, bindArgs, opts)
 	var rowsAffected int64
 	if res != nil {
 		rowsAffected, _ = res.RowsAffected()
@@ -627,19 +438,10 @@ func (t *executor) UpdateForce(data interface{}, expr string, fields []string, o
 	return res, nil
 }
 
-func (t *executor) Update(data interface{}, expr string, args []interface{}, opts *Options) (sql.Result, error) {
-	placeholder := "?"
-	if opts.Placeholder != "" {
-		placeholder = opts.Placeholder
-	}
-	timeLayout := DefaultTimeLayout
-	if opts.TimeLayout != "" {
-		timeLayout = opts.TimeLayout
-	}
-	columnQuotes := "`"
-	if opts.ColumnQuotes != "" {
-		columnQuotes = opts.ColumnQuotes
-	}
+func (t *executor) Update(ctx context.Context, data interface{}, expr string, args []interface{}, opts *Options) (sql.Result, error) {
+	dialect := opts.dialect()
+	ph := newPlaceholders(dialect)
+	timeLayout := opts.timeLayout()
 	var debugFunc DebugFunc
 	if opts.DebugFunc != nil {
 		debugFunc = opts.DebugFunc
@@ -648,78 +450,37 @@ func (t *executor) Update(data interface{}, expr string, args []interface{}, opt
 	set := make([]string, 0)
 	bindArgs := make([]interface{}, 0)
 
-	table := ""
-
 	value := reflect.ValueOf(data)
 	switch value.Kind() {
 	case reflect.Ptr:
-		return t.Update(value.Elem().Interface(), expr, args, opts)
+		return t.Update(ctx, value.Elem().Interface(), expr, args, opts)
 	case reflect.Struct:
-		if tab, ok := data.(Table); ok {
-			table = tab.TableName()
-		} else {
-			table = value.Type().Name()
-		}
-		paramNum := 0 //真正需要更新得字段数量
-		for i := 0; i < value.NumField(); i++ {
-			fieldTypeStr := value.Field(i).Type().String()
-			if !value.Field(i).CanInterface() {
-				continue
-			}
-
-			tag := value.Type().Field(i).Tag.Get("xsql")
-			if tag == "" || tag == "-" || tag == "_" {
-				continue
-			}
-
-			strs := strings.Split(tag, ",")
-			//是否空值忽略该字段
-			var omitempy bool
-			if len(strs) > 1 {
-				for _, s := range strs[1:] {
-					if strings.Contains(s, "omitempty") {
-						omitempy = true
-					}
-				}
-			}
-
-			valueFieldVal := ""
-			if fieldTypeStr == "string" {
-				valueFieldVal = fmt.Sprintf("%s", value.Field(i).Interface())
-			} else if fieldTypeStr == "int" || fieldTypeStr == "int64" || fieldTypeStr == "int32" || fieldTypeStr == "xsql.XsqlInt" {
-				valueFieldVal = fmt.Sprintf("%d", value.Field(i).Interface())
-			}
-
-			//fmt.Println(value.Field(i).Type().String(),value.Field(i).Interface(),valueFieldVal)
-			if omitempy && (valueFieldVal == "" || valueFieldVal == "0") && fieldTypeStr != "xsql.XsqlInt" {
-				continue
-			} else {
-				paramNum++
-				tag = strs[0]
-				if placeholder == "?" {
-					set = append(set, fmt.Sprintf("%s = %s", columnQuotes+tag+columnQuotes, placeholder))
-				} else if placeholder == "@" {
-					set = append(set, fmt.Sprintf("%s = @p%d", columnQuotes+tag+columnQuotes, paramNum))
-				} else {
-					set = append(set, fmt.Sprintf("%s = %s", columnQuotes+tag+columnQuotes, fmt.Sprintf(placeholder, i)))
-				}
-				// time特殊处理
-				if value.Field(i).Type().String() == "time.Time" {
-					ti := value.Field(i).Interface().(time.Time)
-					bindArgs = append(bindArgs, ti.Format(timeLayout))
-				} else {
-					bindArgs = append(bindArgs, value.Field(i).Interface())
-				}
-			}
-
-		}
 		break
 	default:
 		return nil, errors.New("sql: only for struct type")
 	}
+	m, err := modelOf(value.Type())
+	if err != nil {
+		return nil, err
+	}
+	table := m.tableName(data)
+
+	for _, f := range m.fields {
+		fieldValue := value.Field(f.index[0])
+		if !f.updatable() || f.omitempty && f.isEmpty(fieldValue) {
+			continue
+		}
+		v, bindVal := dialect.Bind(ph.next(), fieldValue.Interface(), timeLayout)
+		set = append(set, fmt.Sprintf("%s = %s", dialect.Quote(f.column), f.placeholder(v)))
+		bindArgs = append(bindArgs, bindVal)
+	}
 
 	where := ""
 	if expr != "" {
+		expr, args, err := ph.bind(expr, args, opts.RewritePlaceholder)
+		if err != nil {
+			return nil, err
+		}
 		where = fmt.Sprintf(` WHERE %s`, expr)
 		bindArgs = append(bindArgs, args...)
 	}
@@ -727,7 +488,7 @@ func (t *executor) Update(data interface{}, expr string, args []interface{}, opt
 	SQL := fmt.Sprintf(`UPDATE %s SET %s%s`, table, strings.Join(set, ", "), where)
 
 	startTime := time.Now()
-	res, err := t.Executor.Exec(SQL, bindArgs...)
+	res, err := t.execContext(ctx, SQL, bindArgs, opts)
 	var rowsAffected int64
 	if res != nil {
 		rowsAffected, _ = res.RowsAffected()
@@ -749,23 +510,10 @@ func (t *executor) Update(data interface{}, expr string, args []interface{}, opt
 	return res, nil
 }
 
-func (t *executor) Save(data interface{}, orInsert bool, fields []string, opts *Options) (sql.Result, error) {
-	tt, ok := data.(TableAttribute)
-	if !ok {
-		return nil, errors.New("should implement an interface TableAttribute")
-	}
-	placeholder := "?"
-	if opts.Placeholder != "" {
-		placeholder = opts.Placeholder
-	}
-	timeLayout := DefaultTimeLayout
-	if opts.TimeLayout != "" {
-		timeLayout = opts.TimeLayout
-	}
-	columnQuotes := "`"
-	if opts.ColumnQuotes != "" {
-		columnQuotes = opts.ColumnQuotes
-	}
+func (t *executor) Save(ctx context.Context, data interface{}, orInsert bool, fields []string, opts *Options) (sql.Result, error) {
+	dialect := opts.dialect()
+	ph := newPlaceholders(dialect)
+	timeLayout := opts.timeLayout()
 	var debugFunc DebugFunc
 	if opts.DebugFunc != nil {
 		debugFunc = opts.DebugFunc
@@ -774,109 +522,68 @@ func (t *executor) Save(data interface{}, orInsert bool, fields []string, opts *
 	set := make([]string, 0)
 	bindArgs := make([]interface{}, 0)
 
-	table := ""
-
-	//typeVal := reflect.TypeOf(data)
 	value := reflect.ValueOf(data)
-	//主键值 主键只能是int
-	var primaryVal any
 	switch value.Kind() {
 	case reflect.Ptr:
-		return t.Save(value.Elem().Interface(), orInsert, fields, opts)
+		return t.Save(ctx, value.Elem().Interface(), orInsert, fields, opts)
 	case reflect.Struct:
-		if tab, ok := data.(Table); ok {
-			table = tab.TableName()
-		} else {
-			table = value.Type().Name()
-		}
-		paramNum := 0 //真正需要更新得字段数量
-		typeVal := reflect.TypeOf(data)
-		for i := 0; i < value.NumField(); i++ {
-			//类型
-			fieldTypeStr := value.Field(i).Type().String()
-			//属性名称
-			fieldName := typeVal.Field(i).Name
-			hasForce := false //是否是强制更新的字段
-
-			if !value.Field(i).CanInterface() {
-				continue
-			}
-
-			tag := value.Type().Field(i).Tag.Get("xsql")
-			if tag == "" || tag == "-" || tag == "_" {
-				continue
-			}
-
-			strs := strings.Split(tag, ",")
-			tag = strs[0]
-			//是否空值忽略该字段
-			var omitempy bool
-			if len(strs) > 1 {
-				for _, s := range strs[1:] {
-					if strings.Contains(s, "omitempty") {
-						omitempy = true
-					}
-				}
-			}
-
-			if tag == tt.PrimaryName() {
-				primaryVal = value.Field(i).Interface()
-				if primaryVal == 0 {
-					if !orInsert {
-						return nil, errors.New("primary value zero!")
-					}
-					//如果没有数据则新增
-					return t.Insert(data, opts)
-				}
-				continue
+		break
+	default:
+		return nil, errors.New("sql: only for struct type")
+	}
+	m, err := modelOf(value.Type())
+	if err != nil {
+		return nil, err
+	}
+	table := m.tableName(data)
+	primary := m.primary(data)
+	if len(primary) == 0 {
+		return nil, errPrimaryUndefined
+	}
+	primaryVals := make([]interface{}, 0, len(primary))
+	for _, f := range primary {
+		fieldValue := value.Field(f.index[0])
+		if fieldValue.IsZero() || f.isEmpty(fieldValue) {
+			if !orInsert {
+				return nil, ErrPrimaryKeyZero
 			}
+			//如果没有数据则新增
+			return t.Insert(ctx, data, opts)
+		}
+		primaryVals = append(primaryVals, f.basic(fieldValue))
+	}
 
-			valueFieldVal := ""
-			if fieldTypeStr == "string" {
-				valueFieldVal = fmt.Sprintf("%s", value.Field(i).Interface())
-			} else if fieldTypeStr == "int" || fieldTypeStr == "int64" || fieldTypeStr == "int32" {
-				valueFieldVal = fmt.Sprintf("%d", value.Field(i).Interface())
-			}
-			for _, field := range fields {
-				if field == fieldName {
-					hasForce = true
-				}
-			}
+	for _, f := range m.fields {
+		fieldValue := value.Field(f.index[0])
+		if f.isPrimary(primary) {
+			continue
+		}
 
-			//fmt.Println(value.Field(i).Type().String(),value.Field(i).Interface(),valueFieldVal)
-			if omitempy && (valueFieldVal == "" || valueFieldVal == "0") && !hasForce {
-				continue
-			} else {
-				paramNum++
-				tag = strs[0]
-				if placeholder == "?" {
-					set = append(set, fmt.Sprintf("%s = %s", columnQuotes+tag+columnQuotes, placeholder))
-				} else if placeholder == "@" {
-					set = append(set, fmt.Sprintf("%s = @p%d", columnQuotes+tag+columnQuotes, paramNum))
-				} else {
-					set = append(set, fmt.Sprintf("%s = %s", columnQuotes+tag+columnQuotes, fmt.Sprintf(placeholder, i)))
-				}
-				// time特殊处理
-				if value.Field(i).Type().String() == "time.Time" {
-					ti := value.Field(i).Interface().(time.Time)
-					bindArgs = append(bindArgs, ti.Format(timeLayout))
-				} else {
-					bindArgs = append(bindArgs, value.Field(i).Interface())
-				}
+		//是否是强制更新的字段
+		hasForce := false
+		for _, field := range fields {
+			if field == f.name {
+				hasForce = true
 			}
-
 		}
-		break
-	default:
-		return nil, errors.New("sql: only for struct type")
+		if !f.updatable() || f.omitempty && f.isEmpty(fieldValue) && !hasForce {
+			continue
+		}
+		v, bindVal := dialect.Bind(ph.next(), fieldValue.Interface(), timeLayout)
+		set = append(set, fmt.Sprintf("%s = %s", dialect.Quote(f.column), f.placeholder(v)))
+		bindArgs = append(bindArgs, bindVal)
 	}
 
-	where := fmt.Sprintf(` WHERE %s = %d`, tt.PrimaryName(), primaryVal)
+	where, whereArgs, err := primaryWhere(primary, primaryVals, ph, opts)
+	if err != nil {
+		return nil, err
+	}
+	bindArgs = append(bindArgs, whereArgs...)
 
-	SQL := fmt.Sprintf(`UPDATE %s SET %s%s`, table, strings.Join(set, ", "), where)
+	SQL := fmt.Sprintf(`UPDATE %s SET %s WHERE %s`, table, strings.Join(set, ", "), where)
 
 	startTime := time.Now()
-	res, err := t.Executor.Exec(SQL, bindArgs...)
+	res, err := t.execContext(ctx, SQL, bindArgs, opts)
 	var rowsAffected int64
 	if res != nil {
 		rowsAffected, _ = res.RowsAffected()
@@ -898,14 +605,105 @@ func (t *executor) Save(data interface{}, orInsert bool, fields []string, opts *
 	return res, nil
 }
 
-func (t *executor) Exec(query string, args []interface{}, opts *Options) (sql.Result, error) {
+/*
+@Description: 根据主键删除
+@receiver t
+@param ctx
+@param data 结构体，用于获取表名及主键
+@param primaryVal 主键值，复合主键为按主键顺序的 []interface{}，nil 时使用 data 中的主键值
+@param opts
+@return sql.Result
+@return error
+*/
+func (t *executor) DeleteByPrimary(ctx context.Context, data interface{}, primaryVal any, opts *Options) (sql.Result, error) {
+	typ := reflect.TypeOf(data)
+	if typ == nil {
+		return nil, errors.New("sql: data cannot be nil")
+	}
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	m, err := modelOf(typ)
+	if err != nil {
+		return nil, err
+	}
+	// 可以传入 (*T)(nil) 只用于指定类型，此时需要传入主键值
+	value := reflect.ValueOf(data)
+	for value.Kind() == reflect.Ptr && !value.IsNil() {
+		value = value.Elem()
+	}
+	if value.Kind() == reflect.Ptr {
+		if primaryVal == nil {
+			return nil, errors.New("sql: primary key value is required for a nil pointer")
+		}
+		data = reflect.New(typ).Interface()
+	}
+	primary := m.primary(data)
+	if len(primary) == 0 {
+		return nil, errPrimaryUndefined
+	}
+
+	var primaryVals []interface{}
+	switch val := primaryVal.(type) {
+	case nil:
+		for _, f := range primary {
+			primaryVals = append(primaryVals, f.basic(value.Field(f.index[0])))
+		}
+	case []interface{}:
+		primaryVals = val
+	default:
+		primaryVals = []interface{}{val}
+	}
+	ph := newPlaceholders(opts.dialect())
+	where, args, err := primaryWhere(primary, primaryVals, ph, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	SQL := fmt.Sprintf("DELETE FROM %s WHERE %s", m.tableName(data), where)
+	return t.Exec(ctx, SQL, args, opts)
+}
+
+// errPrimaryUndefined 没有 pk 字段且未实现 TableAttribute、CompositePrimary
+var errPrimaryUndefined = errors.New("sql: primary key is not defined, use the pk option of xsql tag or implement TableAttribute")
+
+/*
+@Description: 生成主键条件，主键值均作为参数绑定，任意主键值为零值时返回 ErrPrimaryKeyZero
+@param primary 主键字段
+@param vals 按主键顺序的值
+@param ph
+@param opts
+@return string
+@return []interface{}
+@return error
+*/
+func primaryWhere(primary []*field, vals []interface{}, ph *placeholders, opts *Options) (string, []interface{}, error) {
+	if len(vals) != len(primary) {
+		return "", nil, fmt.Errorf("sql: primary key has %d columns but got %d values", len(primary), len(vals))
+	}
+	dialect := opts.dialect()
+	timeLayout := opts.timeLayout()
+	where := make([]string, 0, len(primary))
+	args := make([]interface{}, 0, len(primary))
+	for i, f := range primary {
+		if vals[i] == nil || reflect.ValueOf(vals[i]).IsZero() {
+			return "", nil, ErrPrimaryKeyZero
+		}
+		v, bindVal := dialect.Bind(ph.next(), vals[i], timeLayout)
+		where = append(where, fmt.Sprintf("%s = %s", dialect.Quote(f.column), f.placeholder(v)))
+		args = append(args, bindVal)
+	}
+	return strings.Join(where, " AND "), args, nil
+}
+
+func (t *executor) Exec(ctx context.Context, query string, args []interface{}, opts *Options) (sql.Result, error) {
 	var debugFunc DebugFunc
 	if opts.DebugFunc != nil {
 		debugFunc = opts.DebugFunc
 	}
 
 	startTime := time.Now()
-	res, err := t.Executor.Exec(query, args...)
+	res, err := t.execContext(ctx, query, args, opts)
 	var rowsAffected int64
 	if res != nil {
 		rowsAffected, _ = res.RowsAffected()
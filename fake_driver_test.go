@@ -0,0 +1,205 @@
+package xsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+)
+
+// fakeStmt 记录的一次执行
+type fakeStmt struct {
+	SQL  string
+	Args []interface{}
+}
+
+// fakeRecorder 无需数据库服务的驱动，记录执行的SQL并返回预设结果
+type fakeRecorder struct {
+	sync.Mutex
+	Stmts []fakeStmt
+	// 查询返回的结果，未设置时返回空结果集
+	Rows func(query string) ([]string, [][]driver.Value)
+	// 执行返回的结果
+	Result driver.Result
+	// 执行或查询返回的错误
+	Err func(query string) error
+	// 与 Stmts 对应，执行语句的连接序号
+	Conns  []int
+	opened int
+}
+
+func newFakeDB(opts ...Options) (*DB, *fakeRecorder) {
+	rec := &fakeRecorder{
+		Result: driver.RowsAffected(1),
+	}
+	return New(sql.OpenDB(rec), opts...), rec
+}
+
+func (t *fakeRecorder) SQL() []string {
+	t.Lock()
+	defer t.Unlock()
+	s := make([]string, 0, len(t.Stmts))
+	for _, stmt := range t.Stmts {
+		s = append(s, stmt.SQL)
+	}
+	return s
+}
+
+func (t *fakeRecorder) Last() fakeStmt {
+	t.Lock()
+	defer t.Unlock()
+	if len(t.Stmts) == 0 {
+		return fakeStmt{}
+	}
+	return t.Stmts[len(t.Stmts)-1]
+}
+
+func (t *fakeRecorder) record(conn int, query string, args []driver.NamedValue) error {
+	t.Lock()
+	defer t.Unlock()
+	t.Conns = append(t.Conns, conn)
+	a := make([]interface{}, 0, len(args))
+	for _, v := range args {
+		a = append(a, v.Value)
+	}
+	t.Stmts = append(t.Stmts, fakeStmt{SQL: query, Args: a})
+	if t.Err != nil {
+		return t.Err(query)
+	}
+	return nil
+}
+
+func (t *fakeRecorder) Connect(ctx context.Context) (driver.Conn, error) {
+	return t.open(), nil
+}
+
+func (t *fakeRecorder) open() *fakeConn {
+	t.Lock()
+	defer t.Unlock()
+	t.opened++
+	return &fakeConn{rec: t, id: t.opened}
+}
+
+func (t *fakeRecorder) Driver() driver.Driver {
+	return fakeDriver{rec: t}
+}
+
+type fakeDriver struct {
+	rec *fakeRecorder
+}
+
+func (t fakeDriver) Open(name string) (driver.Conn, error) {
+	return t.rec.open(), nil
+}
+
+type fakeConn struct {
+	rec *fakeRecorder
+	id  int
+}
+
+func (t *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakePrepared{conn: t, query: query}, nil
+}
+
+func (t *fakeConn) Close() error {
+	return nil
+}
+
+func (t *fakeConn) Begin() (driver.Tx, error) {
+	return t.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (t *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := t.rec.record(t.id, "BEGIN", nil); err != nil {
+		return nil, err
+	}
+	return &fakeTx{conn: t}, nil
+}
+
+func (t *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := t.rec.record(t.id, query, args); err != nil {
+		return nil, err
+	}
+	return t.rec.Result, nil
+}
+
+func (t *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := t.rec.record(t.id, query, args); err != nil {
+		return nil, err
+	}
+	rows := &fakeRows{}
+	if t.rec.Rows != nil {
+		rows.columns, rows.values = t.rec.Rows(query)
+	}
+	return rows, nil
+}
+
+// CheckNamedValue 接受任意类型的参数
+func (t *fakeConn) CheckNamedValue(v *driver.NamedValue) error {
+	return nil
+}
+
+type fakePrepared struct {
+	conn  *fakeConn
+	query string
+}
+
+func (t *fakePrepared) Close() error {
+	return nil
+}
+
+func (t *fakePrepared) NumInput() int {
+	return -1
+}
+
+func (t *fakePrepared) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, driver.ErrSkip
+}
+
+func (t *fakePrepared) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, driver.ErrSkip
+}
+
+func (t *fakePrepared) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return t.conn.ExecContext(ctx, t.query, args)
+}
+
+func (t *fakePrepared) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return t.conn.QueryContext(ctx, t.query, args)
+}
+
+type fakeTx struct {
+	conn *fakeConn
+}
+
+func (t *fakeTx) Commit() error {
+	return t.conn.rec.record(t.conn.id, "COMMIT", nil)
+}
+
+func (t *fakeTx) Rollback() error {
+	return t.conn.rec.record(t.conn.id, "ROLLBACK", nil)
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+	i       int
+}
+
+func (t *fakeRows) Columns() []string {
+	return t.columns
+}
+
+func (t *fakeRows) Close() error {
+	return nil
+}
+
+func (t *fakeRows) Next(dest []driver.Value) error {
+	if t.i >= len(t.values) {
+		return io.EOF
+	}
+	copy(dest, t.values[t.i])
+	t.i++
+	return nil
+}
@@ -3,11 +3,9 @@ package xsql
 import (
 	"database/sql"
 	"errors"
-	"fmt"
 	ora "github.com/sijms/go-ora/v2"
 	"reflect"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -20,47 +18,54 @@ type Fetcher struct {
 func (t *Fetcher) First(i interface{}) error {
 	value := reflect.ValueOf(i)
 	if value.Kind() != reflect.Ptr {
+		_ = t.R.Close()
 		return errors.New("sql: argument can only be pointer type")
 	}
 	root := value.Elem()
-
-	rows, err := t.Rows()
+	m, err := modelOf(root.Type())
 	if err != nil {
+		_ = t.R.Close()
 		return err
 	}
-	if len(rows) == 0 {
+
+	found := false
+	err = t.fetch(func(columns []string) []interface{} {
+		return m.scanDest(columns, &root, t.Options)
+	}, nil, func() error {
+		found = true
+		return errStopEach
+	})
+	if err == errStopEach {
+		return nil
+	}
+	if err == nil && !found {
 		return sql.ErrNoRows
 	}
-	t.ParseStruct(root, rows, 0)
-	return nil
+	return err
 }
 
 func (t *Fetcher) Find(i interface{}) error {
 	value := reflect.ValueOf(i)
 	if value.Kind() != reflect.Ptr {
+		_ = t.R.Close()
 		return errors.New("sql: argument can only be pointer type")
 	}
 	root := value.Elem()
 	itemType := root.Type().Elem()
-
-	rows, err := t.Rows()
+	m, err := modelOf(itemType)
 	if err != nil {
+		_ = t.R.Close()
 		return err
 	}
 
-	for r := 0; r < len(rows); r++ {
-		newItem := reflect.New(itemType)
-		if newItem.Kind() == reflect.Ptr {
-			newItem = newItem.Elem()
-		}
-		err = t.ParseStruct(newItem, rows, r)
-		if err != nil {
-			return err
-		}
-		root.Set(reflect.Append(root, newItem))
-	}
-
-	return nil
+	var item reflect.Value
+	zero := reflect.Zero(itemType)
+	return t.fetch(func(columns []string) []interface{} {
+		return m.scanDest(columns, &item, t.Options)
+	}, func() {
+		root.Set(reflect.Append(root, zero))
+		item = root.Index(root.Len() - 1)
+	}, nil)
 }
 
 /*
@@ -72,102 +77,147 @@ func (t *Fetcher) Find(i interface{}) error {
 @return error
 */
 func (t *Fetcher) ParseStruct(newItem reflect.Value, rows []Row, r int) error {
-	for n := 0; n < newItem.NumField(); n++ {
-		field := newItem.Field(n)
-		fieldType := field.Kind()
-		if fieldType == reflect.Struct { //判断如果是结构体
-			t.ParseStruct(field, rows, r)
-		}
-		if !field.CanSet() {
-			continue
-		}
-		tag := newItem.Type().Field(n).Tag.Get("xsql")
-		if tag == "-" || tag == "_" {
-			continue
-		}
-
-		strs := strings.Split(tag, ",")
-		//是否空值忽略该字段
-		//var omitempy bool
-		//if len(strs) > 1{
-		//	for _, s := range strs[1:] {
-		//		if strings.Contains(s,"omitempty"){
-		//			omitempy = true
-		//		}
-		//	}
-		//}
-		//if !omitempy{
-		//	fields = append(fields, strs[0])
-		//}else {
-		//	continue
-		//}
-		tag = strs[0]
-		if !rows[r].Exist(tag) {
-			continue
-		}
-		if err := mapped(field, rows[r], tag, t.Options); err != nil {
-			return err
-		}
+	m, err := modelOf(newItem.Type())
+	if err != nil {
+		return err
 	}
-	return nil
+	return m.mapRow(newItem, rows[r], t.Options)
 }
 
 func (t *Fetcher) Rows() ([]Row, error) {
-	var debugFunc DebugFunc
-	if t.Options.DebugFunc != nil {
-		debugFunc = t.Options.DebugFunc
-	}
-
-	// 获取列名
-	columns, err := t.R.Columns()
+	var rows []Row
+	err := t.Each(func(row Row) error {
+		rows = append(rows, row)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return rows, nil
+}
 
-	// Make a slice for the values
-	values := make([]interface{}, len(columns))
-
-	// rows.Scan wants '[]interface{}' as an argument, so we must copy the
-	// references into such a slice
-	// See http://code.google.com/p/go-wiki/wiki/InterfaceSlice for details
-	scanArgs := make([]interface{}, len(values))
-	for i := range values {
-		scanArgs[i] = &values[i]
-	}
-
-	// Fetch rows
-	var rows []Row
-
-	for t.R.Next() {
-		err = t.R.Scan(scanArgs...)
-		if err != nil {
-			return nil, err
+/*
+@Description: 逐行读取数据，不会一次性加载全部结果
+读取结束、fn 返回错误或读取失败时关闭 *sql.Rows，并输出带有已读取行数的日志
+@receiver t
+@param fn 返回错误时停止读取并返回该错误
+@return error
+*/
+func (t *Fetcher) Each(fn func(row Row) error) error {
+	var columns []string
+	var values []interface{}
+	return t.fetch(func(c []string) []interface{} {
+		columns = c
+		// Make a slice for the values
+		values = make([]interface{}, len(columns))
+
+		// rows.Scan wants '[]interface{}' as an argument, so we must copy the
+		// references into such a slice
+		// See http://code.google.com/p/go-wiki/wiki/InterfaceSlice for details
+		scanArgs := make([]interface{}, len(values))
+		for i := range values {
+			scanArgs[i] = &values[i]
 		}
-
-		rowMap := make(map[string]interface{})
+		return scanArgs
+	}, nil, func() error {
+		rowMap := make(map[string]interface{}, len(columns))
 		for i, value := range values {
 			// Here we can check if the value is nil (NULL value)
 			if value != nil {
 				rowMap[columns[i]] = value
 			}
 		}
-
-		rows = append(rows, Row{
+		return fn(Row{
 			v:       rowMap,
+			columns: columns,
 			options: t.Options,
 		})
+	})
+}
+
+/*
+@Description: 逐行读取数据并映射到结构体 i，每行映射前将 i 重置为零值
+@receiver t
+@param i 结构体指针
+@param fn 返回错误时停止读取并返回该错误
+@return error
+*/
+func (t *Fetcher) Iterate(i interface{}, fn func() error) error {
+	value := reflect.ValueOf(i)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		_ = t.R.Close()
+		return errors.New("sql: argument can only be pointer to struct type")
 	}
+	root := value.Elem()
+	m, err := modelOf(root.Type())
+	if err != nil {
+		_ = t.R.Close()
+		return err
+	}
+
+	zero := reflect.Zero(root.Type())
+	return t.fetch(func(columns []string) []interface{} {
+		return m.scanDest(columns, &root, t.Options)
+	}, func() {
+		root.Set(zero)
+	}, fn)
+}
 
-	if debugFunc != nil {
-		t.Log.RowsAffected = int64(len(rows))
-		debugFunc(t.Log)
+/*
+@Description: 逐行扫描数据，读取结束、出错或提前结束时关闭 *sql.Rows，并输出带有已读取行数的日志
+@receiver t
+@param prepare 根据列名生成 Scan 的参数，只调用一次
+@param before 每行扫描前调用，可以为 nil
+@param after 每行扫描后调用，返回错误时停止读取并返回该错误，可以为 nil
+@return err
+*/
+func (t *Fetcher) fetch(prepare func(columns []string) []interface{}, before func(), after func() error) (err error) {
+	var count int64
+	var fetchErr error
+	defer func() {
+		if closeErr := t.R.Close(); fetchErr == nil {
+			fetchErr = closeErr
+		}
+		if err == nil {
+			err = fetchErr
+		}
+		if t.Options.DebugFunc != nil {
+			t.Log.RowsAffected = count
+			t.Log.Error = fetchErr
+			t.Options.DebugFunc(t.Log)
+		}
+	}()
+
+	// 获取列名
+	columns, fetchErr := t.R.Columns()
+	if fetchErr != nil {
+		return nil
 	}
+	dest := prepare(columns)
 
-	return rows, nil
+	for t.R.Next() {
+		if before != nil {
+			before()
+		}
+		if fetchErr = t.R.Scan(dest...); fetchErr != nil {
+			return nil
+		}
+		count++
+
+		if after != nil {
+			if err := after(); err != nil {
+				return err
+			}
+		}
+	}
+	fetchErr = t.Options.wrapError(t.R.Err())
+	return nil
 }
 
 type Row struct {
-	v       map[string]interface{}
+	v map[string]interface{}
+	// 查询结果的列名，按查询顺序
+	columns []string
 	options *Options
 }
 
@@ -333,87 +383,6 @@ func (t *RowResult) Type() string {
 	return reflect.TypeOf(t.v).String()
 }
 
-func mapped(field reflect.Value, row Row, tag string, opts *Options) (err error) {
-	timeLayout := DefaultTimeLayout
-	if opts.TimeLayout != "" {
-		timeLayout = opts.TimeLayout
-	}
-
-	res := row.Get(tag)
-	v := res.Value()
-	fk := field.Kind()
-	if fk == reflect.Struct {
-		fkStr := field.Type().String()
-		switch fkStr {
-		case "sql.NullString":
-			v = sql.NullString{
-				Valid:  true,
-				String: res.String(),
-			}
-			break
-		case "sql.NullInt64":
-			v = sql.NullInt64{
-				Valid: true,
-				Int64: res.Int(),
-			}
-			break
-		}
-	} else {
-		switch field.Kind() {
-		case reflect.Int:
-			v = int(res.Int())
-			break
-		case reflect.Int8:
-			v = int8(res.Int())
-			break
-		case reflect.Int16:
-			v = int16(res.Int())
-			break
-		case reflect.Int32:
-			v = int32(res.Int())
-			break
-		case reflect.Int64:
-			v = res.Int()
-			break
-		case reflect.Uint:
-			v = uint(res.Int())
-			break
-		case reflect.Uint8:
-			v = uint8(res.Int())
-			break
-		case reflect.Uint16:
-			v = uint16(res.Int())
-			break
-		case reflect.Uint32:
-			v = uint32(res.Int())
-			break
-		case reflect.Uint64:
-			v = uint64(res.Int())
-			break
-		case reflect.String:
-			v = res.String()
-			break
-		default:
-			if !res.Empty() &&
-				field.Type().String() == "time.Time" &&
-				reflect.ValueOf(v).Type().String() != "time.Time" {
-				//fmt.Println(res.String())
-				if t, e := time.ParseInLocation(timeLayout, res.String(), time.Local); e == nil {
-					v = t
-				} else {
-					return fmt.Errorf("time parse fail for field %s: %v", tag, e)
-				}
-			}
-		}
-	}
-
-	// 追加异常信息
-	defer func() {
-		if e := recover(); e != nil {
-			err = fmt.Errorf("type mismatch for field %s: %v", tag, e)
-		}
-	}()
-	field.Set(reflect.ValueOf(v))
-
-	return
+func mapped(field reflect.Value, row Row, tag string, opts *Options) error {
+	return setField(field, converterOf(field.Type()), row.Get(tag).Value(), tag, opts)
 }
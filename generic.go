@@ -0,0 +1,129 @@
+package xsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"time"
+)
+
+// Querier *DB 与 *Tx 共用的逐行查询接口
+type Querier interface {
+	Each(ctx context.Context, query string, args []interface{}, fn func(row Row) error) error
+}
+
+// FindAs 查询全部行并映射为 T
+// T 为结构体或结构体指针时按 xsql tag 映射，其他类型取每行的第一列
+func FindAs[T any](db Querier, query string, args ...interface{}) ([]T, error) {
+	return FindAsContext[T](context.Background(), db, query, args...)
+}
+
+func FindAsContext[T any](ctx context.Context, db Querier, query string, args ...interface{}) ([]T, error) {
+	items := make([]T, 0)
+	err := db.Each(ctx, query, args, func(row Row) error {
+		item, err := scanAs[T](row)
+		if err != nil {
+			return err
+		}
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// FirstAs 查询第一行并映射为 T，没有数据时返回 sql.ErrNoRows
+func FirstAs[T any](db Querier, query string, args ...interface{}) (T, error) {
+	return FirstAsContext[T](context.Background(), db, query, args...)
+}
+
+func FirstAsContext[T any](ctx context.Context, db Querier, query string, args ...interface{}) (T, error) {
+	var item T
+	found := false
+	err := db.Each(ctx, query, args, func(row Row) error {
+		var err error
+		if item, err = scanAs[T](row); err != nil {
+			return err
+		}
+		found = true
+		return errStopEach
+	})
+	if err == errStopEach {
+		return item, nil
+	}
+	if err == nil && !found {
+		err = sql.ErrNoRows
+	}
+	return item, err
+}
+
+// errStopEach 读取到需要的数据后提前结束 Each
+var errStopEach = errors.New("sql: stop each")
+
+// Scalar 查询第一行第一列，如 COUNT(*)、MAX(id)，没有数据时返回 sql.ErrNoRows，T 为指针时 NULL 返回 nil
+func Scalar[T any](db Querier, query string, args ...interface{}) (T, error) {
+	return ScalarContext[T](context.Background(), db, query, args...)
+}
+
+func ScalarContext[T any](ctx context.Context, db Querier, query string, args ...interface{}) (T, error) {
+	return FirstAsContext[T](ctx, db, query, args...)
+}
+
+// scanAs 将一行数据映射为 T
+func scanAs[T any](row Row) (T, error) {
+	var item T
+	value := reflect.ValueOf(&item).Elem()
+	if err := scanValue(value, row); err != nil {
+		return item, err
+	}
+	return item, nil
+}
+
+/*
+@Description: 将一行数据映射到 value
+结构体按 xsql tag 映射，指针为 NULL 时保持 nil，其他类型取第一列
+@param value
+@param row
+@return error
+*/
+func scanValue(value reflect.Value, row Row) error {
+	if value.Kind() == reflect.Ptr {
+		elem := reflect.New(value.Type().Elem())
+		if !isStructValue(elem.Elem()) && (len(row.columns) == 0 || !row.Exist(row.columns[0])) {
+			return nil
+		}
+		if err := scanValue(elem.Elem(), row); err != nil {
+			return err
+		}
+		value.Set(elem)
+		return nil
+	}
+
+	if isStructValue(value) {
+		f := Fetcher{
+			Options: row.options,
+		}
+		return f.ParseStruct(value, []Row{row}, 0)
+	}
+	if len(row.columns) == 0 || !row.Exist(row.columns[0]) {
+		return nil
+	}
+	return mapped(value, row, row.columns[0], row.options)
+}
+
+// isStructValue 是否按 xsql tag 映射，time.Time 及 sql.NullString 等实现了 sql.Scanner 的结构体作为单列的值
+func isStructValue(value reflect.Value) bool {
+	if value.Kind() != reflect.Struct {
+		return false
+	}
+	if value.Type() == reflect.TypeOf(time.Time{}) {
+		return false
+	}
+	if _, ok := value.Addr().Interface().(sql.Scanner); ok {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+package xsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFindAs(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	tests, err := FindAs[TestSqlite](DB, "SELECT * FROM xsql ORDER BY id")
+	a.Empty(err)
+	a.Len(tests, 2)
+	a.Equal("{Id:1 Foo:v Bar:2022-04-14 23:49:48}", tests[0].String())
+	a.Equal("{Id:2 Foo:v1 Bar:2022-04-14 23:50:00}", tests[1].String())
+
+	ptrs, err := FindAs[*TestSqlite](DB, "SELECT * FROM xsql WHERE id = ?", 2)
+	a.Empty(err)
+	a.Len(ptrs, 1)
+	a.Equal("v1", ptrs[0].Foo)
+
+	ids, err := FindAs[int64](DB, "SELECT id FROM xsql ORDER BY id DESC")
+	a.Empty(err)
+	a.Equal([]int64{2, 1}, ids)
+
+	foos, err := FindAs[string](DB, "SELECT foo FROM xsql WHERE id IN (?)", []int{1, 2})
+	a.Empty(err)
+	a.ElementsMatch([]string{"v", "v1"}, foos)
+
+	empty, err := FindAs[TestSqlite](DB, "SELECT * FROM xsql WHERE id > ?", 100)
+	a.Empty(err)
+	a.Len(empty, 0)
+}
+
+func TestFirstAs(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	test, err := FirstAs[TestSqlite](DB, "SELECT * FROM xsql ORDER BY id")
+	a.Empty(err)
+	a.Equal(1, test.Id)
+
+	ptr, err := FirstAs[*TestSqlite](DB, "SELECT * FROM xsql ORDER BY id DESC")
+	a.Empty(err)
+	a.Equal(2, ptr.Id)
+
+	bar, err := FirstAs[time.Time](DB, "SELECT bar FROM xsql WHERE id = ?", 1)
+	a.Empty(err)
+	a.Equal("2022-04-14 23:49:48", bar.Format(DefaultTimeLayout))
+
+	_, err = FirstAs[TestSqlite](DB, "SELECT * FROM xsql WHERE id > ?", 100)
+	a.ErrorIs(err, sql.ErrNoRows)
+
+	// 读取第一行后关闭结果集，连接可以继续使用
+	count, err := Scalar[int](DB, "SELECT COUNT(*) FROM xsql")
+	a.Empty(err)
+	a.Equal(2, count)
+}
+
+func TestScalar(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	count, err := Scalar[int64](DB, "SELECT COUNT(*) FROM xsql WHERE foo = ?", "v")
+	a.Empty(err)
+	a.Equal(int64(1), count)
+
+	foo, err := Scalar[string](DB, "SELECT foo FROM xsql WHERE id = ?", 2)
+	a.Empty(err)
+	a.Equal("v1", foo)
+
+	nullFoo, err := Scalar[sql.NullString](DB, "SELECT foo FROM xsql WHERE id = ?", 2)
+	a.Empty(err)
+	a.Equal(sql.NullString{String: "v1", Valid: true}, nullFoo)
+
+	// NULL
+	max, err := Scalar[*int64](DB, "SELECT MAX(id) FROM xsql WHERE id > ?", 100)
+	a.Empty(err)
+	a.Nil(max)
+
+	max, err = Scalar[*int64](DB, "SELECT MAX(id) FROM xsql")
+	a.Empty(err)
+	a.Equal(int64(2), *max)
+
+	_, err = Scalar[int](DB, "SELECT id FROM xsql WHERE id > ?", 100)
+	a.ErrorIs(err, sql.ErrNoRows)
+
+	// 事务
+	tx, err := DB.Begin()
+	a.Empty(err)
+	_, err = tx.Exec("INSERT INTO xsql (id, foo) VALUES (?, ?)", 3, "tx")
+	a.Empty(err)
+	count, err = ScalarContext[int64](context.Background(), tx, "SELECT COUNT(*) FROM xsql")
+	a.Empty(err)
+	a.Equal(int64(3), count)
+	tests, err := FindAsContext[TestSqlite](context.Background(), tx, "SELECT * FROM xsql WHERE foo = ?", "tx")
+	a.Empty(err)
+	a.Len(tests, 1)
+	a.Empty(tx.Rollback())
+}
+
+func TestScalarBytes(t *testing.T) {
+	a := assert.New(t)
+
+	// mysql 的文本协议及 DECIMAL 以 []byte 返回
+	DB, rec := newFakeDB()
+	value := []byte("1.5")
+	rec.Rows = func(query string) ([]string, [][]driver.Value) {
+		return []string{"v"}, [][]driver.Value{{value}}
+	}
+
+	avg, err := Scalar[float64](DB, "SELECT AVG(amount) FROM xsql")
+	a.Empty(err)
+	a.Equal(1.5, avg)
+
+	avg32, err := Scalar[float32](DB, "SELECT AVG(amount) FROM xsql")
+	a.Empty(err)
+	a.Equal(float32(1.5), avg32)
+
+	value = []byte("1")
+	ok, err := Scalar[bool](DB, "SELECT EXISTS (SELECT 1 FROM xsql)")
+	a.Empty(err)
+	a.True(ok)
+
+	// 结构体字段同样转换
+	type TestAmount struct {
+		Amount float64 `xsql:"amount"`
+		Valid  bool    `xsql:"valid"`
+	}
+	rec.Rows = func(query string) ([]string, [][]driver.Value) {
+		return []string{"amount", "valid"}, [][]driver.Value{{[]byte("2.25"), []byte("true")}, {value, int64(0)}}
+	}
+	tests, err := FindAs[TestAmount](DB, "SELECT amount, valid FROM xsql")
+	a.Empty(err)
+	a.Equal([]TestAmount{{Amount: 2.25, Valid: true}, {Amount: 1}}, tests)
+
+	rec.Rows = func(query string) ([]string, [][]driver.Value) {
+		return []string{"v"}, [][]driver.Value{{value}}
+	}
+	value = []byte("x")
+	_, err = Scalar[float64](DB, "SELECT AVG(amount) FROM xsql")
+	a.ErrorContains(err, "invalid syntax")
+}
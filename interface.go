@@ -1,11 +1,16 @@
 package xsql
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+)
 
 type Executor interface {
 	Exec(query string, args ...interface{}) (sql.Result, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 }
 
 type Query interface {
 	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
 }
@@ -9,6 +9,8 @@ type Log struct {
 	Bindings     []interface{} `json:"bindings"`
 	RowsAffected int64         `json:"rowsAffected"`
 	Error        error         `json:"error"`
+	Retry        int           `json:"retry,omitempty"` // 大于 0 时表示本次执行失败，即将进行第 Retry 次重试
+	Chunk        int           `json:"chunk,omitempty"` // 大于 0 时表示 BatchInsert、BatchUpdate 分组、拆分后的第 Chunk 条语句
 }
 
 type DebugFunc func(l *Log)
@@ -0,0 +1,577 @@
+package xsql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	ora "github.com/sijms/go-ora/v2"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// model 结构体的解析结果，每个类型只解析一次，供插入、更新及查询映射共用
+type model struct {
+	typ reflect.Type
+	// 写入的字段：导出且设置了 xsql tag 的顶层字段，按声明顺序
+	fields []*field
+	// 查询映射的字段，包含嵌套结构体中的字段，按声明顺序
+	scan []*field
+	// 列名对应的查询映射字段
+	columns map[string][]*field
+}
+
+// field 结构体字段
+type field struct {
+	// 属性名称
+	name string
+	// 列名，未引用
+	column string
+	// 在结构体中的位置，嵌套结构体为多级
+	index []int
+	typ   reflect.Type
+	// 空值时忽略该字段
+	omitempty bool
+	// 主键
+	pk bool
+	// 自增，插入时为空值则忽略，更新时不写入
+	autoincr bool
+	// 只读，不写入
+	readonly bool
+	// 仅插入时写入
+	insertonly bool
+	// 仅更新时写入
+	updateonly bool
+	// 插入时为空值则使用该 SQL 表达式
+	def string
+	// 绑定参数时转换的 SQL 类型
+	sqlType string
+	// 判断空值，nil 表示该类型没有空值
+	empty func(v reflect.Value) bool
+	// 插入时使用的值，sql.NullString、sql.NullInt64 转换为基础类型
+	basic func(v reflect.Value) interface{}
+	// 查询结果转换为字段类型
+	convert converter
+}
+
+// models 已解析的结构体 reflect.Type => *model
+var models sync.Map
+
+/*
+@Description: 获取结构体的解析结果，首次使用时解析并缓存，并发安全
+@param typ 结构体类型
+@return *model
+@return error
+*/
+func modelOf(typ reflect.Type) (*model, error) {
+	if m, ok := models.Load(typ); ok {
+		return m.(*model), nil
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, errors.New("sql: only for struct type")
+	}
+
+	m := &model{
+		typ:     typ,
+		fields:  make([]*field, 0, typ.NumField()),
+		scan:    make([]*field, 0, typ.NumField()),
+		columns: make(map[string][]*field),
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag := sf.Tag.Get("xsql")
+		if tag == "" || tag == "-" || tag == "_" {
+			continue
+		}
+		f, err := newField(sf, []int{i}, tag)
+		if err != nil {
+			return nil, err
+		}
+		m.fields = append(m.fields, f)
+	}
+	if err := m.parseScan(typ, nil); err != nil {
+		return nil, err
+	}
+
+	actual, _ := models.LoadOrStore(typ, m)
+	return actual.(*model), nil
+}
+
+// parseScan 解析查询映射的字段，递归解析嵌套的结构体
+func (t *model) parseScan(typ reflect.Type, index []int) error {
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		fieldIndex := append(index[:len(index):len(index)], i)
+		if sf.Type.Kind() == reflect.Struct {
+			if err := t.parseScan(sf.Type, fieldIndex); err != nil {
+				return err
+			}
+		}
+
+		tag := sf.Tag.Get("xsql")
+		if tag == "" || tag == "-" || tag == "_" {
+			continue
+		}
+		f, err := newField(sf, fieldIndex, tag)
+		if err != nil {
+			return err
+		}
+		if f.column == "" {
+			continue
+		}
+		t.scan = append(t.scan, f)
+		t.columns[f.column] = append(t.columns[f.column], f)
+	}
+	return nil
+}
+
+// tableName 实现了 Table 接口时使用 TableName()，否则使用类型名称
+func (t *model) tableName(data interface{}) string {
+	if tab, ok := data.(Table); ok {
+		return tab.TableName()
+	}
+	return t.typ.Name()
+}
+
+// mapRow 将一行数据映射到结构体
+func (t *model) mapRow(value reflect.Value, row Row, opts *Options) error {
+	for _, f := range t.scan {
+		v, ok := row.v[f.column]
+		if !ok {
+			continue
+		}
+		if err := setField(value.FieldByIndex(f.index), f.convert, v, f.column, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// columnScanner 查询结果的列直接扫描到当前行结构体的字段，NULL 时字段保持不变
+type columnScanner struct {
+	// 当前行的结构体
+	root   *reflect.Value
+	fields []*field
+	opts   *Options
+}
+
+func (t *columnScanner) Scan(src interface{}) error {
+	if src == nil {
+		return nil
+	}
+	for _, f := range t.fields {
+		if err := setField(t.root.FieldByIndex(f.index), f.convert, src, f.column, t.opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discardScanner 没有对应字段的列
+type discardScanner struct{}
+
+func (discardScanner) Scan(src interface{}) error {
+	return nil
+}
+
+/*
+@Description: 根据查询结果的列名生成 Scan 的参数，列与字段的对应关系只解析一次
+@receiver t
+@param columns
+@param root 当前行的结构体，每行扫描前更新
+@param opts
+@return []interface{}
+*/
+func (t *model) scanDest(columns []string, root *reflect.Value, opts *Options) []interface{} {
+	dest := make([]interface{}, len(columns))
+	for i, column := range columns {
+		fields, ok := t.columns[column]
+		if !ok {
+			dest[i] = discardScanner{}
+			continue
+		}
+		dest[i] = &columnScanner{
+			root:   root,
+			fields: fields,
+			opts:   opts,
+		}
+	}
+	return dest
+}
+
+/*
+@Description: 解析字段的 xsql tag，格式为 "列名,选项,选项"，不支持的选项返回错误
+选项：omitempty、pk、autoincr、readonly、insertonly、updateonly、default=<SQL 表达式>、type=<SQL 类型>
+@param sf
+@param index
+@param tag
+@return *field
+@return error
+*/
+func newField(sf reflect.StructField, index []int, tag string) (*field, error) {
+	strs := splitTag(tag)
+	f := &field{
+		name:    sf.Name,
+		column:  strings.TrimSpace(strs[0]),
+		index:   index,
+		typ:     sf.Type,
+		empty:   emptyFunc(sf.Type),
+		basic:   basicFunc(sf.Type),
+		convert: converterOf(sf.Type),
+	}
+	for _, opt := range strs[1:] {
+		opt = strings.TrimSpace(opt)
+		key, value, _ := strings.Cut(opt, "=")
+		switch key {
+		case "":
+		case "omitempty":
+			f.omitempty = true
+		case "pk":
+			f.pk = true
+		case "autoincr":
+			f.autoincr = true
+		case "readonly":
+			f.readonly = true
+		case "insertonly":
+			f.insertonly = true
+		case "updateonly":
+			f.updateonly = true
+		case "default":
+			f.def = value
+		case "type":
+			f.sqlType = value
+		default:
+			return nil, fmt.Errorf("sql: unknown option %q in xsql tag of field %s", opt, sf.Name)
+		}
+		if (key == "default" || key == "type") && value == "" {
+			return nil, fmt.Errorf("sql: option %q requires a value in xsql tag of field %s", key, sf.Name)
+		}
+	}
+	if f.readonly && (f.insertonly || f.updateonly) || f.insertonly && f.updateonly {
+		return nil, fmt.Errorf("sql: readonly, insertonly and updateonly are exclusive in xsql tag of field %s", sf.Name)
+	}
+	return f, nil
+}
+
+// splitTag 按逗号拆分 xsql tag，括号内的逗号不拆分，如 type=DECIMAL(10,2)
+func splitTag(tag string) []string {
+	strs := make([]string, 0, 2)
+	depth, start := 0, 0
+	for i, c := range tag {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				strs = append(strs, tag[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(strs, tag[start:])
+}
+
+// insertable 插入时是否写入
+func (t *field) insertable() bool {
+	return !t.readonly && !t.updateonly
+}
+
+// updatable 更新时是否写入
+func (t *field) updatable() bool {
+	return !t.readonly && !t.insertonly && !t.autoincr
+}
+
+// insertDefault 插入时是否使用 default 表达式
+func (t *field) insertDefault(v reflect.Value) bool {
+	return t.def != "" && (v.IsZero() || t.isEmpty(v))
+}
+
+// insertSkip 插入时是否忽略该字段：omitempty、autoincr 的空值
+func (t *field) insertSkip(v reflect.Value) bool {
+	if t.insertDefault(v) {
+		return false
+	}
+	return (t.omitempty || t.autoincr) && (t.isEmpty(v) || t.autoincr && v.IsZero())
+}
+
+// placeholder 设置了 type 时转换绑定参数的类型
+func (t *field) placeholder(p string) string {
+	if t.sqlType == "" {
+		return p
+	}
+	return fmt.Sprintf("CAST(%s AS %s)", p, t.sqlType)
+}
+
+/*
+@Description: 主键字段，依次使用 pk 标记、CompositePrimary 的 PrimaryNames()、TableAttribute 的 PrimaryName()
+@receiver t
+@param data
+@return []*field 没有主键时为空
+*/
+func (t *model) primary(data interface{}) []*field {
+	primary := make([]*field, 0, 1)
+	for _, f := range t.fields {
+		if f.pk {
+			primary = append(primary, f)
+		}
+	}
+	if len(primary) > 0 {
+		return primary
+	}
+
+	var names []string
+	if tab, ok := data.(CompositePrimary); ok {
+		names = tab.PrimaryNames()
+	} else if tab, ok := data.(TableAttribute); ok {
+		names = []string{tab.PrimaryName()}
+	}
+	for _, name := range names {
+		f := t.field(name)
+		if f == nil {
+			return nil
+		}
+		primary = append(primary, f)
+	}
+	return primary
+}
+
+// field 列名对应的写入字段
+func (t *model) field(column string) *field {
+	for _, f := range t.fields {
+		if f.column == column {
+			return f
+		}
+	}
+	return nil
+}
+
+// isPrimary 是否为主键字段
+func (t *field) isPrimary(primary []*field) bool {
+	for _, f := range primary {
+		if f == t {
+			return true
+		}
+	}
+	return false
+}
+
+// lastIdColumn 获取自增 id 的列，优先使用 autoincr 字段，其次为单一主键
+func (t *model) lastIdColumn(data interface{}) string {
+	for _, f := range t.fields {
+		if f.autoincr {
+			return f.column
+		}
+	}
+	if primary := t.primary(data); len(primary) == 1 {
+		return primary[0].column
+	}
+	return ""
+}
+
+// isEmpty omitempty 判断的空值
+func (t *field) isEmpty(v reflect.Value) bool {
+	return t.empty != nil && t.empty(v)
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	nullStringType = reflect.TypeOf(sql.NullString{})
+	nullInt64Type  = reflect.TypeOf(sql.NullInt64{})
+	xsqlIntType    = reflect.TypeOf(XsqlInt(0))
+	scannerType    = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+// emptyFunc 空值判断：字符串、整数、[]byte 的零值，无效的 sql.NullString、sql.NullInt64
+// XsqlInt 用于需要写入 0 的字段，不视为空值
+func emptyFunc(typ reflect.Type) func(v reflect.Value) bool {
+	switch typ {
+	case xsqlIntType:
+		return nil
+	case nullStringType, nullInt64Type:
+		return func(v reflect.Value) bool {
+			return !v.FieldByName("Valid").Bool()
+		}
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		return func(v reflect.Value) bool {
+			return v.Len() == 0
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(v reflect.Value) bool {
+			return v.Int() == 0
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(v reflect.Value) bool {
+			return v.Uint() == 0
+		}
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return func(v reflect.Value) bool {
+				return v.Len() == 0
+			}
+		}
+	}
+	return nil
+}
+
+// basicFunc 插入时使用的值
+func basicFunc(typ reflect.Type) func(v reflect.Value) interface{} {
+	switch typ {
+	case nullStringType:
+		return func(v reflect.Value) interface{} {
+			s := v.Interface().(sql.NullString)
+			if !s.Valid {
+				return ""
+			}
+			return s.String
+		}
+	case nullInt64Type:
+		return func(v reflect.Value) interface{} {
+			i := v.Interface().(sql.NullInt64)
+			if !i.Valid {
+				return 0
+			}
+			return i.Int64
+		}
+	}
+	return func(v reflect.Value) interface{} {
+		return v.Interface()
+	}
+}
+
+// converter 将查询结果转换为字段类型并设置字段的值
+type converter func(field reflect.Value, v interface{}, opts *Options) error
+
+// converters 字段类型 reflect.Type => converter
+var converters sync.Map
+
+// converterOf 字段类型对应的转换，首次使用时生成并缓存
+func converterOf(typ reflect.Type) converter {
+	if c, ok := converters.Load(typ); ok {
+		return c.(converter)
+	}
+	c := newConverter(typ)
+	converters.Store(typ, c)
+	return c
+}
+
+func newConverter(typ reflect.Type) converter {
+	switch typ {
+	case nullStringType:
+		return func(field reflect.Value, v interface{}, opts *Options) error {
+			res := RowResult{v: v, options: opts}
+			field.Set(reflect.ValueOf(sql.NullString{
+				Valid:  true,
+				String: res.String(),
+			}))
+			return nil
+		}
+	case nullInt64Type:
+		return func(field reflect.Value, v interface{}, opts *Options) error {
+			res := RowResult{v: v, options: opts}
+			field.Set(reflect.ValueOf(sql.NullInt64{
+				Valid: true,
+				Int64: res.Int(),
+			}))
+			return nil
+		}
+	case timeType:
+		return func(field reflect.Value, v interface{}, opts *Options) error {
+			var tt time.Time
+			switch val := v.(type) {
+			case time.Time:
+				tt = val
+			case ora.TimeStamp:
+				tt = time.Time(val)
+			default:
+				res := RowResult{v: v, options: opts}
+				if res.Empty() {
+					break
+				}
+				var err error
+				if tt, err = time.ParseInLocation(opts.timeLayout(), res.String(), time.Local); err != nil {
+					return err
+				}
+			}
+			field.Set(reflect.ValueOf(tt))
+			return nil
+		}
+	}
+
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(field reflect.Value, v interface{}, opts *Options) error {
+			res := RowResult{v: v, options: opts}
+			field.SetInt(res.Int())
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(field reflect.Value, v interface{}, opts *Options) error {
+			res := RowResult{v: v, options: opts}
+			field.SetUint(uint64(res.Int()))
+			return nil
+		}
+	case reflect.String:
+		return func(field reflect.Value, v interface{}, opts *Options) error {
+			res := RowResult{v: v, options: opts}
+			field.SetString(res.String())
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		// 按 database/sql 的规则转换，mysql 的 DECIMAL 等以 []byte 返回
+		return func(field reflect.Value, v interface{}, opts *Options) error {
+			var f sql.NullFloat64
+			if err := f.Scan(v); err != nil {
+				return err
+			}
+			field.SetFloat(f.Float64)
+			return nil
+		}
+	case reflect.Bool:
+		return func(field reflect.Value, v interface{}, opts *Options) error {
+			var b sql.NullBool
+			if err := b.Scan(v); err != nil {
+				return err
+			}
+			field.SetBool(b.Bool)
+			return nil
+		}
+	}
+	if reflect.PtrTo(typ).Implements(scannerType) {
+		return func(field reflect.Value, v interface{}, opts *Options) error {
+			return field.Addr().Interface().(sql.Scanner).Scan(v)
+		}
+	}
+	return func(field reflect.Value, v interface{}, opts *Options) error {
+		// 直接扫描时 []byte 在读取下一行后会被覆盖
+		if b, ok := v.([]byte); ok {
+			v = append([]byte(nil), b...)
+		}
+		field.Set(reflect.ValueOf(v))
+		return nil
+	}
+}
+
+// setField 转换并设置字段的值，类型不匹配时返回错误
+func setField(field reflect.Value, convert converter, v interface{}, column string, opts *Options) (err error) {
+	// 追加异常信息
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("type mismatch for field %s: %v", column, e)
+		}
+	}()
+	if err := convert(field, v, opts); err != nil {
+		return fmt.Errorf("convert fail for field %s: %v", column, err)
+	}
+	return nil
+}
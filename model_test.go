@@ -0,0 +1,395 @@
+package xsql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	ora "github.com/sijms/go-ora/v2"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type TestModelBase struct {
+	Created time.Time `xsql:"created"`
+}
+
+type TestModel struct {
+	TestModelBase
+	Id      XsqlInt        `xsql:"id,omitempty"`
+	Foo     string         `xsql:"foo,omitempty"`
+	Data    []byte         `xsql:"data,omitempty"`
+	Remark  sql.NullString `xsql:"remark,omitempty"`
+	Count   uint32         `xsql:"count"`
+	Ignored string         `xsql:"-"`
+	NoTag   string
+	private string `xsql:"private"`
+}
+
+func (t TestModel) TableName() string {
+	return "model"
+}
+
+func TestModelOf(t *testing.T) {
+	a := assert.New(t)
+
+	m, err := modelOf(reflect.TypeOf(TestModel{}))
+	a.Empty(err)
+
+	columns := make([]string, 0)
+	for _, f := range m.fields {
+		columns = append(columns, f.column)
+	}
+	a.Equal([]string{"id", "foo", "data", "remark", "count"}, columns)
+	a.True(m.fields[1].omitempty)
+	a.False(m.fields[4].omitempty)
+
+	// 查询映射包含嵌套结构体的字段
+	columns = columns[:0]
+	for _, f := range m.scan {
+		columns = append(columns, f.column)
+	}
+	a.Equal([]string{"created", "id", "foo", "data", "remark", "count"}, columns)
+	a.Equal([]int{0, 0}, m.columns["created"][0].index)
+	a.Equal("model", m.tableName(TestModel{}))
+
+	_, err = modelOf(reflect.TypeOf(1))
+	a.Error(err)
+
+	// 并发获取同一个解析结果
+	var wg sync.WaitGroup
+	results := make([]*model, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = modelOf(reflect.TypeOf(TestModelBase{}))
+		}(i)
+	}
+	wg.Wait()
+	for _, r := range results {
+		a.Same(results[0], r)
+	}
+}
+
+func TestModelOmitempty(t *testing.T) {
+	a := assert.New(t)
+
+	DB, rec := newFakeDB()
+
+	_, err := DB.Insert(&TestModel{Data: []byte("data"), Remark: sql.NullString{String: "remark", Valid: true}})
+	a.Empty(err)
+	a.Equal("INSERT INTO model (`id`, `data`, `remark`, `count`) VALUES (?, ?, ?, ?)", rec.Last().SQL)
+	a.Equal([]interface{}{XsqlInt(0), []byte("data"), "remark", uint32(0)}, rec.Last().Args)
+
+	_, err = DB.Update(&TestModel{Foo: "foo"}, "id = ?", 1)
+	a.Empty(err)
+	a.Equal("UPDATE model SET `id` = ?, `foo` = ?, `count` = ? WHERE id = ?", rec.Last().SQL)
+}
+
+func TestModelMapping(t *testing.T) {
+	a := assert.New(t)
+
+	DB, rec := newFakeDB()
+	rec.Rows = func(query string) ([]string, [][]driver.Value) {
+		return []string{"created", "id", "foo", "remark", "count"}, [][]driver.Value{
+			{"2022-04-14 23:49:48", int64(1), []byte("foo"), "remark", int64(3)},
+			{time.Date(2022, 4, 14, 23, 50, 0, 0, time.Local), int64(2), "bar", nil, int64(4)},
+		}
+	}
+
+	var tests []TestModel
+	err := DB.Find(&tests, "SELECT * FROM model")
+	a.Empty(err)
+	a.Len(tests, 2)
+	a.Equal("2022-04-14 23:49:48", tests[0].Created.Format(DefaultTimeLayout))
+	a.Equal(XsqlInt(1), tests[0].Id)
+	a.Equal("foo", tests[0].Foo)
+	a.Equal(sql.NullString{String: "remark", Valid: true}, tests[0].Remark)
+	a.Equal(uint32(3), tests[0].Count)
+	a.Equal("2022-04-14 23:50:00", tests[1].Created.Format(DefaultTimeLayout))
+	a.False(tests[1].Remark.Valid)
+
+	// 类型不匹配
+	rec.Rows = func(query string) ([]string, [][]driver.Value) {
+		return []string{"data"}, [][]driver.Value{{int64(1)}}
+	}
+	var test TestModel
+	err = DB.First(&test, "SELECT data FROM model")
+	a.ErrorContains(err, "type mismatch for field data")
+
+	rec.Rows = func(query string) ([]string, [][]driver.Value) {
+		return []string{"created"}, [][]driver.Value{{"yesterday"}}
+	}
+	err = DB.First(&test, "SELECT created FROM model")
+	a.ErrorContains(err, "convert fail for field created")
+}
+
+func TestModelOracleTime(t *testing.T) {
+	a := assert.New(t)
+
+	var test TestModelBase
+	field := reflect.ValueOf(&test).Elem().Field(0)
+	created := time.Date(2022, 4, 14, 23, 49, 48, 0, time.Local)
+	err := setField(field, converterOf(field.Type()), ora.TimeStamp(created), "created", &Options{})
+	a.Empty(err)
+	a.Equal(created, test.Created)
+}
+
+type TestModelScan struct {
+	Id      int64        `xsql:"id"`
+	Foo     string       `xsql:"foo"`
+	Deleted sql.NullTime `xsql:"deleted"`
+	Data    []byte       `xsql:"data"`
+}
+
+func TestModelScanDirect(t *testing.T) {
+	a := assert.New(t)
+
+	DB, rec := newFakeDB()
+	var logs []*Log
+	DB.Options.DebugFunc = func(l *Log) {
+		logs = append(logs, l)
+	}
+	deleted := time.Date(2022, 4, 14, 23, 49, 48, 0, time.Local)
+	rec.Rows = func(query string) ([]string, [][]driver.Value) {
+		return []string{"id", "unknown", "foo", "deleted", "data"}, [][]driver.Value{
+			{int64(1), "x", "foo", deleted, []byte("data")},
+			{int64(2), "y", nil, nil, nil},
+		}
+	}
+
+	var tests []TestModelScan
+	err := DB.Find(&tests, "SELECT * FROM model")
+	a.Empty(err)
+	a.Equal([]TestModelScan{
+		{Id: 1, Foo: "foo", Deleted: sql.NullTime{Time: deleted, Valid: true}, Data: []byte("data")},
+		{Id: 2},
+	}, tests)
+	a.Equal(int64(2), logs[0].RowsAffected)
+
+	// 读取第一行后结束
+	var test TestModelScan
+	err = DB.First(&test, "SELECT * FROM model")
+	a.Empty(err)
+	a.Equal(int64(1), test.Id)
+	a.Equal(int64(1), logs[1].RowsAffected)
+
+	// NULL 时字段保持不变
+	rec.Rows = func(query string) ([]string, [][]driver.Value) {
+		return []string{"id", "foo"}, [][]driver.Value{{int64(2), nil}}
+	}
+	test = TestModelScan{Foo: "keep"}
+	err = DB.First(&test, "SELECT id, foo FROM model WHERE id = 2")
+	a.Empty(err)
+	a.Equal(TestModelScan{Id: 2, Foo: "keep"}, test)
+
+	rec.Rows = nil
+	err = DB.First(&test, "SELECT * FROM model WHERE id = 3")
+	a.ErrorIs(err, sql.ErrNoRows)
+}
+
+type TestModelTag struct {
+	Id      int64     `xsql:"id,pk,autoincr"`
+	Name    string    `xsql:"name"`
+	Version int64     `xsql:"version,readonly"`
+	Created time.Time `xsql:"created,insertonly,default=CURRENT_TIMESTAMP"`
+	Updated string    `xsql:"updated,updateonly"`
+	Amount  string    `xsql:"amount, omitempty, type=DECIMAL(10,2)"`
+}
+
+func (t TestModelTag) TableName() string {
+	return "tag"
+}
+
+func TestModelTagOption(t *testing.T) {
+	a := assert.New(t)
+
+	m, err := modelOf(reflect.TypeOf(TestModelTag{}))
+	a.Empty(err)
+	a.True(m.fields[0].pk)
+	a.True(m.fields[0].autoincr)
+	a.Equal("CURRENT_TIMESTAMP", m.fields[3].def)
+	// 括号内的逗号不拆分
+	a.Equal("DECIMAL(10,2)", m.fields[5].sqlType)
+	a.True(m.fields[5].omitempty)
+
+	type unknown struct {
+		Id int64 `xsql:"id,primary"`
+	}
+	_, err = modelOf(reflect.TypeOf(unknown{}))
+	a.ErrorContains(err, `unknown option "primary" in xsql tag of field Id`)
+
+	type noValue struct {
+		Id int64 `xsql:"id,default="`
+	}
+	_, err = modelOf(reflect.TypeOf(noValue{}))
+	a.ErrorContains(err, `option "default" requires a value`)
+
+	type exclusive struct {
+		Id int64 `xsql:"id,readonly,insertonly"`
+	}
+	_, err = modelOf(reflect.TypeOf(exclusive{}))
+	a.ErrorContains(err, "exclusive")
+
+	DB, _ := newFakeDB()
+	_, err = DB.Insert(&unknown{Id: 1})
+	a.ErrorContains(err, "unknown option")
+}
+
+func TestModelTagWrite(t *testing.T) {
+	a := assert.New(t)
+
+	DB, rec := newFakeDB()
+	created := time.Date(2022, 4, 14, 23, 49, 48, 0, time.Local)
+
+	// autoincr 为空值时由数据库生成，default 在空值时使用表达式
+	_, err := DB.Insert(&TestModelTag{Name: "foo", Version: 2, Updated: "x", Amount: "1.50"})
+	a.Empty(err)
+	a.Equal("INSERT INTO tag (`name`, `created`, `amount`) VALUES (?, CURRENT_TIMESTAMP, CAST(? AS DECIMAL(10,2)))", rec.Last().SQL)
+	a.Equal([]interface{}{"foo", "1.50"}, rec.Last().Args)
+
+	_, err = DB.Insert(&TestModelTag{Id: 3, Name: "foo", Created: created})
+	a.Empty(err)
+	a.Equal("INSERT INTO tag (`id`, `name`, `created`) VALUES (?, ?, ?)", rec.Last().SQL)
+
+	_, err = DB.BatchInsert([]TestModelTag{{Name: "foo"}, {Name: "bar", Created: created}})
+	a.Empty(err)
+	a.Equal("INSERT INTO tag (`name`, `created`) VALUES (?, CURRENT_TIMESTAMP), (?, ?)", rec.Last().SQL)
+	a.Len(rec.Last().Args, 3)
+
+	// autoincr 有值的行单独插入
+	_, err = DB.BatchInsert([]TestModelTag{{Name: "foo"}, {Id: 3, Name: "bar"}})
+	a.Empty(err)
+	a.Equal("INSERT INTO tag (`id`, `name`, `created`) VALUES (?, ?, CURRENT_TIMESTAMP)", rec.Stmts[len(rec.Stmts)-2].SQL)
+
+	// 更新不写入 autoincr、readonly、insertonly 字段，强制更新也不写入
+	_, err = DB.Update(&TestModelTag{Id: 1, Name: "foo", Version: 2, Created: created, Updated: "x", Amount: "1.50"}, "id = ?", 1)
+	a.Empty(err)
+	a.Equal("UPDATE tag SET `name` = ?, `updated` = ?, `amount` = CAST(? AS DECIMAL(10,2)) WHERE id = ?", rec.Last().SQL)
+
+	_, err = DB.UpdateForce(&TestModelTag{Name: "foo"}, "id = 1", "Amount", "Version")
+	a.Empty(err)
+	a.Equal("UPDATE tag SET `name` = ?, `updated` = ?, `amount` = CAST(? AS DECIMAL(10,2)) WHERE id = 1", rec.Last().SQL)
+
+	// 未实现 TableAttribute 时使用 pk 字段
+	_, err = DB.Save(&TestModelTag{Id: 1, Name: "foo"}, false, nil)
+	a.Empty(err)
+	a.Equal("UPDATE tag SET `name` = ?, `updated` = ? WHERE `id` = ?", rec.Last().SQL)
+	a.Equal([]interface{}{"foo", "", int64(1)}, rec.Last().Args)
+
+	// 强制更新 omitempty 的空值
+	_, err = DB.Save(&TestModelTag{Id: 1, Name: "foo"}, false, []string{"Amount"})
+	a.Empty(err)
+	a.Equal("UPDATE tag SET `name` = ?, `updated` = ?, `amount` = CAST(? AS DECIMAL(10,2)) WHERE `id` = ?", rec.Last().SQL)
+	a.Equal([]interface{}{"foo", "", "", int64(1)}, rec.Last().Args)
+
+	_, err = DB.DeleteByPrimary(TestModelTag{}, 1)
+	a.Empty(err)
+	a.Equal("DELETE FROM tag WHERE `id` = ?", rec.Last().SQL)
+
+	_, err = DB.Save(&TestModelBase{}, false, nil)
+	a.ErrorContains(err, "primary key is not defined")
+	_, err = DB.DeleteByPrimary(TestModelBase{}, 1)
+	a.ErrorContains(err, "primary key is not defined")
+}
+
+func TestModelTagLastId(t *testing.T) {
+	a := assert.New(t)
+
+	DB, rec := newFakeDB(Postgres())
+	rec.Rows = func(query string) ([]string, [][]driver.Value) {
+		return []string{"id"}, [][]driver.Value{{int64(3)}}
+	}
+
+	// 未实现 TableAttribute 时使用 autoincr 字段
+	res, err := DB.InsertTakeLastId(&TestModelTag{Name: "foo"}, "")
+	a.Empty(err)
+	a.Equal(`INSERT INTO tag ("name", "created") VALUES ($1, CURRENT_TIMESTAMP) RETURNING "id"`, rec.Last().SQL)
+	id, _ := res.LastInsertId()
+	a.Equal(int64(3), id)
+}
+
+func TestLastIdFollowConn(t *testing.T) {
+	a := assert.New(t)
+
+	DB, rec := newFakeDB(Oracle())
+	rec.Rows = func(query string) ([]string, [][]driver.Value) {
+		return []string{"INSERT_ID"}, [][]driver.Value{{int64(5)}}
+	}
+	// 不保留空闲连接，两次调用不使用同一个连接时连接序号不同
+	DB.GetRawDB().SetMaxIdleConns(0)
+
+	res, err := DB.InsertTakeLastId(&TestModelTag{Name: "foo"}, "TAG_SEQ")
+	a.Empty(err)
+	id, _ := res.LastInsertId()
+	a.Equal(int64(5), id)
+	a.Equal(`SELECT TAG_SEQ.CURRVAL INSERT_ID FROM DUAL`, rec.Last().SQL)
+	a.Len(rec.Conns, 2)
+	a.Equal(rec.Conns[0], rec.Conns[1])
+}
+
+type TestModelComposite struct {
+	TenantId string `xsql:"tenant_id"`
+	Code     string `xsql:"code"`
+	Name     string `xsql:"name"`
+}
+
+func (t TestModelComposite) TableName() string {
+	return "composite"
+}
+
+func (t TestModelComposite) PrimaryNames() []string {
+	return []string{"tenant_id", "code"}
+}
+
+func TestModelCompositePrimary(t *testing.T) {
+	a := assert.New(t)
+
+	DB, rec := newFakeDB()
+
+	_, err := DB.Save(&TestModelComposite{TenantId: "t1", Code: "c1", Name: "foo"}, false, nil)
+	a.Empty(err)
+	a.Equal("UPDATE composite SET `name` = ? WHERE `tenant_id` = ? AND `code` = ?", rec.Last().SQL)
+	a.Equal([]interface{}{"foo", "t1", "c1"}, rec.Last().Args)
+
+	// 任意主键为零值时不执行
+	count := len(rec.SQL())
+	_, err = DB.Save(&TestModelComposite{TenantId: "t1", Name: "foo"}, false, nil)
+	a.ErrorIs(err, ErrPrimaryKeyZero)
+	_, err = DB.DeleteByPrimary(TestModelComposite{TenantId: "t1"}, nil)
+	a.ErrorIs(err, ErrPrimaryKeyZero)
+	_, err = DB.DeleteByPrimary(TestModelComposite{}, []interface{}{"t1", ""})
+	a.ErrorIs(err, ErrPrimaryKeyZero)
+	_, err = DB.DeleteByPrimary(TestModelComposite{}, "t1")
+	a.ErrorContains(err, "primary key has 2 columns but got 1 values")
+	a.Len(rec.SQL(), count)
+
+	// 零值时新增
+	_, err = DB.Save(&TestModelComposite{TenantId: "t1", Name: "foo"}, true, nil)
+	a.Empty(err)
+	a.Equal("INSERT INTO composite (`tenant_id`, `code`, `name`) VALUES (?, ?, ?)", rec.Last().SQL)
+
+	_, err = DB.DeleteByPrimary(&TestModelComposite{TenantId: "t1", Code: "c1"}, nil)
+	a.Empty(err)
+	a.Equal("DELETE FROM composite WHERE `tenant_id` = ? AND `code` = ?", rec.Last().SQL)
+	a.Equal([]interface{}{"t1", "c1"}, rec.Last().Args)
+
+	_, err = DB.DeleteByPrimary(TestModelComposite{}, []interface{}{"t2", "c2"})
+	a.Empty(err)
+	a.Equal([]interface{}{"t2", "c2"}, rec.Last().Args)
+
+	// nil 指针只用于指定类型
+	_, err = DB.DeleteByPrimary((*TestModelComposite)(nil), []interface{}{"t3", "c3"})
+	a.Empty(err)
+	a.Equal("DELETE FROM composite WHERE `tenant_id` = ? AND `code` = ?", rec.Last().SQL)
+	a.Equal([]interface{}{"t3", "c3"}, rec.Last().Args)
+	_, err = DB.DeleteByPrimary((*TestModelTag)(nil), 1)
+	a.Empty(err)
+	a.Equal("DELETE FROM tag WHERE `id` = ?", rec.Last().SQL)
+	_, err = DB.DeleteByPrimary((*TestModelComposite)(nil), nil)
+	a.ErrorContains(err, "primary key value is required for a nil pointer")
+	_, err = DB.DeleteByPrimary(nil, 1)
+	a.ErrorContains(err, "data cannot be nil")
+}
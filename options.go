@@ -1,40 +1,76 @@
 package xsql
 
-import "fmt"
-
 // Options
 // 默认为mysql模式
 type Options struct {
 	// 默认: INSERT INTO
 	InsertKey string
 
-	// 默认: ?
-	// oracle 可配置为 :%d
-	Placeholder string
+	// 默认: MysqlDialect
+	// oracle 使用 OracleDialect，sql server 使用 MssqlDialect，postgresql 使用 PostgresDialect，sqlite 使用 SqliteDialect
+	Dialect Dialect
 
-	// 默认：`
-	// oracle 可配置为 "
-	ColumnQuotes string
+	// 默认: false
+	// 开启后 SQL 中统一使用 ? 作为占位符，按方言改写为 :N、@pN、$N
+	RewritePlaceholder bool
 
 	// 默认：== DefaultTimeLayout
 	TimeLayout string
 
-	// 默认：== DefaultTimeFunc
-	// oracle 可修改这个闭包增加 TO_TIMESTAMP
-	TimeFunc TimeFunc
-
 	// 全局 debug SQL
 	DebugFunc DebugFunc
+
+	// 默认: nil 不重试
+	// 死锁、锁等待超时等临时错误的重试策略，可使用 DefaultRetryPolicy()
+	Retry *RetryPolicy
+
+	// 默认: nil 按方言的绑定参数限制拆分
+	// BatchInsert、BatchUpdate 拆分为多条语句的策略
+	Batch *BatchPolicy
+}
+
+func (t *Options) dialect() Dialect {
+	if t.Dialect == nil {
+		return MysqlDialect{}
+	}
+	return t.Dialect
+}
+
+func (t *Options) timeLayout() string {
+	if t.TimeLayout == "" {
+		return DefaultTimeLayout
+	}
+	return t.TimeLayout
 }
 
 // Oracle
 // 使用oracle模式
 func Oracle() Options {
 	return Options{
-		Placeholder:  `:%d`,
-		ColumnQuotes: `"`,
-		TimeFunc: func(placeholder string) string {
-			return fmt.Sprintf("TO_TIMESTAMP(%s, 'SYYYY-MM-DD HH24:MI:SS:FF6')", placeholder)
-		},
+		Dialect: OracleDialect{},
+	}
+}
+
+// Mssql
+// 使用sql server模式
+func Mssql() Options {
+	return Options{
+		Dialect: MssqlDialect{},
+	}
+}
+
+// Postgres
+// 使用postgresql模式
+func Postgres() Options {
+	return Options{
+		Dialect: PostgresDialect{},
+	}
+}
+
+// Sqlite
+// 使用sqlite模式
+func Sqlite() Options {
+	return Options{
+		Dialect: SqliteDialect{},
 	}
 }
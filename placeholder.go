@@ -0,0 +1,448 @@
+package xsql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// placeholders 占位符分配器
+// 同一条语句中的 SET、VALUES 与调用方传入的条件语句共用编号，从 1 开始连续递增
+type placeholders struct {
+	dialect Dialect
+	n       int
+}
+
+func newPlaceholders(dialect Dialect) *placeholders {
+	return &placeholders{
+		dialect: dialect,
+	}
+}
+
+// next 分配下一个占位符
+func (t *placeholders) next() string {
+	t.n++
+	return t.dialect.Placeholder(t.n)
+}
+
+/*
+@Description: 改写调用方传入的 SQL 中的占位符并整理绑定参数
+自行编号的占位符顺延到已分配的编号之后，例如 oracle 已分配 :1 :2 时，条件 "ID = :1" 变为 "ID = :3"
+question 为 true 时 ? 按方言改写并依次编号，同一条 SQL 中不要与编号占位符混用
+仅传入一个 map 或结构体参数时，:name 命名参数按方言改写，参数按出现顺序展开，同名参数可重复使用
+[NOT] IN ( ) 中的切片参数展开为多个占位符，其他位置的切片原样绑定
+@receiver t
+@param query
+@param args
+@param question
+@return string
+@return []interface{}
+@return error
+*/
+func (t *placeholders) bind(query string, args []interface{}, question bool) (string, []interface{}, error) {
+	tokens := scanPlaceholders(query, t.dialect)
+
+	var named map[string]interface{}
+	if len(args) == 1 {
+		for _, tok := range tokens {
+			if tok.kind == tokenNamed {
+				named = namedArgs(args[0])
+				break
+			}
+		}
+	}
+	if named == nil && !hasSliceArg(args) {
+		return t.rewrite(query, tokens, question), args, nil
+	}
+	return t.expand(query, tokens, args, named, question)
+}
+
+// rewrite 仅改写占位符，参数不变
+func (t *placeholders) rewrite(query string, tokens []token, question bool) string {
+	offset := t.n
+	var b strings.Builder
+	last := 0
+	for _, tok := range tokens {
+		var p string
+		switch {
+		case tok.kind == tokenNumbered:
+			p = t.dialect.Placeholder(tok.n + offset)
+			if tok.n+offset > t.n {
+				t.n = tok.n + offset
+			}
+		case tok.kind == tokenQuestion && question:
+			p = t.next()
+		default:
+			continue
+		}
+		b.WriteString(query[last:tok.start])
+		b.WriteString(p)
+		last = tok.end
+	}
+	b.WriteString(query[last:])
+	return b.String()
+}
+
+// inListLimit IN 条件元素数量有上限的方言
+type inListLimit interface {
+	inListLimit() int
+}
+
+// inListLimit ORA-01795: maximum number of expressions in a list is 1000
+func (OracleDialect) inListLimit() int {
+	return 1000
+}
+
+// inExpr 占位符之前的 "字段 [NOT] IN ("
+var inExpr = regexp.MustCompile("(?i)([\\w.$\"`\\[\\]]+)\\s+(not\\s+)?in\\s*\\(\\s*$")
+
+// inClose 占位符之后的 ")"
+var inClose = regexp.MustCompile(`^\s*\)`)
+
+// expand 按占位符出现的顺序重新分配占位符并整理参数
+// IN 条件中的切片参数展开为多个占位符，超过方言 IN 条件上限时拆分为多个 IN 条件以 OR 连接 (NOT IN 以 AND 连接)
+func (t *placeholders) expand(query string, tokens []token, args []interface{}, named map[string]interface{}, question bool) (string, []interface{}, error) {
+	// ? 是否对应参数
+	positional := question || t.dialect.Placeholder(1) == t.dialect.Placeholder(2)
+	limit := 0
+	if l, ok := t.dialect.(inListLimit); ok {
+		limit = l.inListLimit()
+	}
+
+	bindArgs := make([]interface{}, 0, len(args))
+	out := make([]byte, 0, len(query))
+	last := 0
+	qi := 0
+	for _, tok := range tokens {
+		var v interface{}
+		switch {
+		case tok.kind == tokenQuestion && positional:
+			if qi >= len(args) {
+				return "", nil, fmt.Errorf("sql: missing argument for placeholder ? at %d", tok.start)
+			}
+			v = args[qi]
+			qi++
+		case tok.kind == tokenNumbered:
+			if tok.n < 1 || tok.n > len(args) {
+				return "", nil, fmt.Errorf("sql: missing argument for placeholder %s", query[tok.start:tok.end])
+			}
+			v = args[tok.n-1]
+		case tok.kind == tokenNamed && named != nil:
+			var ok bool
+			if v, ok = named[tok.name]; !ok {
+				return "", nil, fmt.Errorf("sql: missing named parameter %s", tok.name)
+			}
+		default:
+			continue
+		}
+		out = append(out, query[last:tok.start]...)
+		last = tok.end
+
+		// 只展开直接位于 [NOT] IN ( ) 中的切片，其他位置的切片 (如 oracle 数组绑定) 原样传给驱动
+		loc := inExpr.FindSubmatchIndex(out)
+		closing := inClose.FindString(query[last:])
+		items, ok := sliceArg(v)
+		if !ok || loc == nil || closing == "" {
+			out = append(out, t.next()...)
+			bindArgs = append(bindArgs, v)
+			continue
+		}
+		if len(items) == 0 {
+			return "", nil, fmt.Errorf("sql: empty slice for placeholder %s", query[tok.start:tok.end])
+		}
+
+		groups := [][]interface{}{items}
+		if limit > 0 && len(items) > limit {
+			groups = make([][]interface{}, 0, len(items)/limit+1)
+			for i := 0; i < len(items); i += limit {
+				end := i + limit
+				if end > len(items) {
+					end = len(items)
+				}
+				groups = append(groups, items[i:end])
+			}
+		}
+		if len(groups) == 1 {
+			for i, item := range items {
+				if i > 0 {
+					out = append(out, ", "...)
+				}
+				out = append(out, t.next()...)
+				bindArgs = append(bindArgs, item)
+			}
+			continue
+		}
+
+		// (ID IN (:1, ...) OR ID IN (:1001, ...))
+		operand := string(out[loc[2]:loc[3]])
+		in, join := " IN (", " OR "
+		if loc[4] >= 0 {
+			in, join = " NOT IN (", " AND "
+		}
+		out = append(out[:loc[0]], '(')
+		for g, group := range groups {
+			if g > 0 {
+				out = append(out, join...)
+			}
+			out = append(out, operand+in...)
+			for i, item := range group {
+				if i > 0 {
+					out = append(out, ", "...)
+				}
+				out = append(out, t.next()...)
+				bindArgs = append(bindArgs, item)
+			}
+			out = append(out, ')')
+		}
+		out = append(out, ')')
+		last += len(closing)
+	}
+	out = append(out, query[last:]...)
+	return string(out), bindArgs, nil
+}
+
+// sliceArg 需要展开的切片参数，[]byte 及实现了 driver.Valuer 的类型除外
+func sliceArg(v interface{}) ([]interface{}, bool) {
+	if v == nil {
+		return nil, false
+	}
+	if _, ok := v.(driver.Valuer); ok {
+		return nil, false
+	}
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			return nil, false
+		}
+		items := make([]interface{}, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			items = append(items, value.Index(i).Interface())
+		}
+		return items, true
+	}
+	return nil, false
+}
+
+func hasSliceArg(args []interface{}) bool {
+	for _, v := range args {
+		if _, ok := sliceArg(v); ok {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+@Description: 命名参数，支持 key 为字符串的 map 及结构体，结构体使用 xsql tag 作为参数名
+@param arg
+@return map[string]interface{} 不支持的类型返回 nil
+*/
+func namedArgs(arg interface{}) map[string]interface{} {
+	value := reflect.ValueOf(arg)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		named := make(map[string]interface{}, value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			named[iter.Key().String()] = iter.Value().Interface()
+		}
+		return named
+	case reflect.Struct:
+		if _, ok := value.Interface().(driver.Valuer); ok {
+			return nil
+		}
+		if _, ok := value.Interface().(time.Time); ok {
+			return nil
+		}
+		// sql.Named 由驱动绑定
+		if _, ok := value.Interface().(sql.NamedArg); ok {
+			return nil
+		}
+		named := make(map[string]interface{})
+		for i := 0; i < value.NumField(); i++ {
+			if !value.Field(i).CanInterface() {
+				continue
+			}
+			tag := value.Type().Field(i).Tag.Get("xsql")
+			if tag == "" || tag == "-" || tag == "_" {
+				continue
+			}
+			named[strings.Split(tag, ",")[0]] = value.Field(i).Interface()
+		}
+		// 没有 xsql 标签的结构体不作为命名参数
+		if len(named) == 0 {
+			return nil
+		}
+		return named
+	}
+	return nil
+}
+
+type tokenKind int
+
+const (
+	// ?
+	tokenQuestion tokenKind = iota
+	// 方言的编号占位符 :1 @p1 $1
+	tokenNumbered
+	// 命名参数 :name
+	tokenNamed
+)
+
+// token SQL 中的占位符
+type token struct {
+	kind  tokenKind
+	start int
+	end   int
+	n     int
+	name  string
+}
+
+// backslashEscapes 字符串中使用反斜杠转义的方言
+type backslashEscapes interface {
+	backslashEscapes() bool
+}
+
+func (MysqlDialect) backslashEscapes() bool {
+	return true
+}
+
+/*
+@Description: 扫描 SQL 中的占位符，跳过字符串、引用的标识符及注释
+@param query
+@param dialect
+@return []token
+*/
+func scanPlaceholders(query string, dialect Dialect) []token {
+	// 编号占位符的前缀，"?" 这类不编号的方言为空
+	prefix := ""
+	if p := dialect.Placeholder(1); p != dialect.Placeholder(2) {
+		prefix = strings.TrimSuffix(p, "1")
+	}
+	brackets := dialect.Quote("") == "[]"
+	// postgresql 的美元引用 $tag$...$tag$ 与转义字符串 E'...'
+	postgres := prefix == "$"
+	backslash := false
+	if b, ok := dialect.(backslashEscapes); ok {
+		backslash = b.backslashEscapes()
+	}
+
+	tokens := make([]token, 0)
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'':
+			i = skipQuoted(query, i, '\'', backslash)
+		case postgres && (c == 'E' || c == 'e') && i+1 < len(query) && query[i+1] == '\'' && !(i > 0 && isIdentChar(query[i-1])):
+			i = skipQuoted(query, i+1, '\'', true)
+		case postgres && c == '$' && !(i > 0 && isIdentChar(query[i-1])) && dollarTag(query[i:]) != "":
+			tag := dollarTag(query[i:])
+			if end := strings.Index(query[i+len(tag):], tag); end >= 0 {
+				i += len(tag) + end + len(tag)
+			} else {
+				i = len(query)
+			}
+		case c == '"' || c == '`':
+			i = skipQuoted(query, i, c, false)
+		case c == '[' && brackets:
+			i = skipQuoted(query, i, ']', false)
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(query)
+			}
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(query)
+			}
+		case c == '?':
+			tokens = append(tokens, token{kind: tokenQuestion, start: i, end: i + 1})
+			i++
+		case c == ':' && strings.HasPrefix(query[i:], "::"):
+			// postgresql 类型转换
+			i += 2
+		case c == ':' && i+1 < len(query) && isIdentStart(query[i+1]) && !(i > 0 && isIdentChar(query[i-1])):
+			end := i + 1
+			for end < len(query) && isIdentChar(query[end]) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenNamed, start: i, end: end, name: query[i+1 : end]})
+			i = end
+		case prefix != "" && strings.HasPrefix(query[i:], prefix) && !(i > 0 && isIdentChar(query[i-1])):
+			end := i + len(prefix)
+			for end < len(query) && query[end] >= '0' && query[end] <= '9' {
+				end++
+			}
+			if end == i+len(prefix) {
+				i++
+				continue
+			}
+			n, _ := strconv.Atoi(query[i+len(prefix) : end])
+			tokens = append(tokens, token{kind: tokenNumbered, start: i, end: end, n: n})
+			i = end
+		default:
+			i++
+		}
+	}
+	return tokens
+}
+
+// dollarTag 返回 s 开头的美元引用标签，如 "$$"、"$body$"，不是标签时返回空
+func dollarTag(s string) string {
+	end := 1
+	if end < len(s) && isIdentStart(s[end]) {
+		for end < len(s) && isIdentChar(s[end]) {
+			end++
+		}
+	}
+	if end < len(s) && s[end] == '$' {
+		return s[:end+1]
+	}
+	return ""
+}
+
+// skipQuoted 跳过以 query[i] 开始、以 closing 结束的引用内容，连续两个 closing 视为转义
+func skipQuoted(query string, i int, closing byte, backslash bool) int {
+	for i++; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if backslash {
+				i++
+			}
+		case closing:
+			if i+1 < len(query) && query[i+1] == closing {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return i
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
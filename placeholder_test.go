@@ -0,0 +1,241 @@
+package xsql
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func bindQuery(ph *placeholders, query string, question bool) string {
+	query, _, _ = ph.bind(query, nil, question)
+	return query
+}
+
+func TestPlaceholderRenumber(t *testing.T) {
+	a := assert.New(t)
+
+	ph := newPlaceholders(OracleDialect{})
+	ph.next()
+	ph.next()
+	a.Equal("ID = :3 AND FOO = ':1' AND BAR > :4 AND ID <> :3", bindQuery(ph, "ID = :1 AND FOO = ':1' AND BAR > :2 AND ID <> :1", false))
+	a.Equal(":5", ph.next())
+
+	ph = newPlaceholders(MssqlDialect{})
+	ph.next()
+	a.Equal("[@p1] = @p2 /* @p1 */ AND id = @p3", bindQuery(ph, "[@p1] = @p1 /* @p1 */ AND id = @p2", false))
+
+	ph = newPlaceholders(PostgresDialect{})
+	ph.next()
+	a.Equal("id = $2 AND bar::text = $3 -- $1\n", bindQuery(ph, "id = $1 AND bar::text = $2 -- $1\n", false))
+
+	ph = newPlaceholders(MysqlDialect{})
+	ph.next()
+	a.Equal("id = ? AND foo = 'it\\'s ?'", bindQuery(ph, "id = ? AND foo = 'it\\'s ?'", false))
+}
+
+func TestPlaceholderPostgresQuote(t *testing.T) {
+	a := assert.New(t)
+
+	// 美元引用与转义字符串中的内容不是占位符
+	ph := newPlaceholders(PostgresDialect{})
+	ph.next()
+	a.Equal("id = $2 AND foo = $$ $1 ? $$ AND bar = $3", bindQuery(ph, "id = $1 AND foo = $$ $1 ? $$ AND bar = $2", false))
+
+	ph = newPlaceholders(PostgresDialect{})
+	a.Equal("DO $body$ BEGIN PERFORM '$$ ?'; END $body$; SELECT $1", bindQuery(ph, "DO $body$ BEGIN PERFORM '$$ ?'; END $body$; SELECT ?", true))
+
+	ph = newPlaceholders(PostgresDialect{})
+	a.Equal("foo = E'it\\'s ?' AND bar = $1 AND name = $2", bindQuery(ph, "foo = E'it\\'s ?' AND bar = ? AND name = ?", true))
+
+	// 未闭合的美元引用直到语句结束
+	ph = newPlaceholders(PostgresDialect{})
+	a.Equal("id = $1 AND foo = $tag$ ?", bindQuery(ph, "id = ? AND foo = $tag$ ?", true))
+
+	// 其他方言不识别
+	a.Equal("foo = :1 AND bar = $$ :2 $$", bindQuery(newPlaceholders(OracleDialect{}), "foo = ? AND bar = $$ ? $$", true))
+}
+
+func TestOraclePlaceholderUpdate(t *testing.T) {
+	a := assert.New(t)
+
+	DB, rec := newFakeDB(Oracle())
+
+	test := TestPg{
+		Foo: "test update",
+		Bar: time.Now(),
+	}
+	_, err := DB.Update(&test, "id = :1 AND foo <> :2", 3, "v")
+	a.Empty(err)
+
+	last := rec.Last()
+	a.Equal(`UPDATE xsql SET "foo" = :1, "bar" = TO_TIMESTAMP(:2, 'SYYYY-MM-DD HH24:MI:SS:FF6') WHERE id = :3 AND foo <> :4`, last.SQL)
+	a.Equal([]interface{}{"test update", test.Bar.Format(DefaultTimeLayout), 3, "v"}, last.Args)
+}
+
+func TestOraclePlaceholderInsert(t *testing.T) {
+	a := assert.New(t)
+
+	DB, rec := newFakeDB(Oracle())
+
+	type TestSkip struct {
+		Id      int    `xsql:"ID,omitempty"`
+		Skip    string `xsql:"-"`
+		Foo     string `xsql:"FOO"`
+		private string
+		Bar     string `xsql:"BAR"`
+	}
+	_, err := DB.Insert(&TestSkip{Foo: "a", Bar: "b"})
+	a.Empty(err)
+	a.Equal(`INSERT INTO TestSkip ("FOO", "BAR") VALUES (:1, :2)`, rec.Last().SQL)
+}
+
+func TestRewritePlaceholder(t *testing.T) {
+	a := assert.New(t)
+
+	query := `SELECT * FROM xsql WHERE id = ? AND foo = '?' AND "b?" = ? -- ?` + "\n" + `/* ? */ AND bar > ?`
+
+	a.Equal(`SELECT * FROM xsql WHERE id = :1 AND foo = '?' AND "b?" = :2 -- ?`+"\n"+`/* ? */ AND bar > :3`,
+		bindQuery(newPlaceholders(OracleDialect{}), query, true))
+	a.Equal(`SELECT * FROM xsql WHERE id = @p1 AND foo = '?' AND "b?" = @p2 -- ?`+"\n"+`/* ? */ AND bar > @p3`,
+		bindQuery(newPlaceholders(MssqlDialect{}), query, true))
+	a.Equal(`SELECT * FROM xsql WHERE id = $1 AND foo = '?' AND "b?" = $2 -- ?`+"\n"+`/* ? */ AND bar > $3`,
+		bindQuery(newPlaceholders(PostgresDialect{}), query, true))
+	a.Equal(query, bindQuery(newPlaceholders(MysqlDialect{}), query, true))
+}
+
+func TestRewritePlaceholderDB(t *testing.T) {
+	a := assert.New(t)
+
+	opts := Oracle()
+	opts.RewritePlaceholder = true
+	DB, rec := newFakeDB(opts)
+
+	_, err := DB.Query("SELECT * FROM XSQL WHERE ID = ? AND FOO = ?", 1, "v")
+	a.Empty(err)
+	a.Equal("SELECT * FROM XSQL WHERE ID = :1 AND FOO = :2", rec.Last().SQL)
+
+	_, err = DB.Exec("DELETE FROM XSQL WHERE ID = ?", 1)
+	a.Empty(err)
+	a.Equal("DELETE FROM XSQL WHERE ID = :1", rec.Last().SQL)
+
+	_, err = DB.Update(&TestPg{Foo: "test update", Bar: time.Now()}, "id = ?", 1)
+	a.Empty(err)
+	a.Equal(`UPDATE xsql SET "foo" = :1, "bar" = TO_TIMESTAMP(:2, 'SYYYY-MM-DD HH24:MI:SS:FF6') WHERE id = :3`, rec.Last().SQL)
+}
+
+func TestNamedArgs(t *testing.T) {
+	a := assert.New(t)
+
+	query, args, err := newPlaceholders(OracleDialect{}).bind(
+		"SELECT * FROM XSQL WHERE FOO = :foo AND BAR > :since AND ID <> :id AND FOO <> ':foo' AND BAR < :since",
+		[]interface{}{map[string]interface{}{"foo": "v", "since": "2022-04-14", "id": 1}}, false)
+	a.Empty(err)
+	a.Equal("SELECT * FROM XSQL WHERE FOO = :1 AND BAR > :2 AND ID <> :3 AND FOO <> ':foo' AND BAR < :4", query)
+	a.Equal([]interface{}{"v", "2022-04-14", 1, "2022-04-14"}, args)
+
+	query, args, err = newPlaceholders(MysqlDialect{}).bind("SELECT * FROM xsql WHERE foo = :foo AND id = :id",
+		[]interface{}{&TestSqlite{Id: 1, Foo: "v"}}, false)
+	a.Empty(err)
+	a.Equal("SELECT * FROM xsql WHERE foo = ? AND id = ?", query)
+	a.Equal([]interface{}{"v", 1}, args)
+
+	_, _, err = newPlaceholders(MysqlDialect{}).bind("SELECT * FROM xsql WHERE foo = :bar",
+		[]interface{}{map[string]interface{}{"foo": "v"}}, false)
+	a.EqualError(err, "sql: missing named parameter bar")
+
+	// 非命名参数不改写
+	query, args, err = newPlaceholders(OracleDialect{}).bind("DELETE FROM XSQL WHERE ID = :id", []interface{}{999}, false)
+	a.Empty(err)
+	a.Equal("DELETE FROM XSQL WHERE ID = :id", query)
+	a.Equal([]interface{}{999}, args)
+
+	// sql.Named 与没有 xsql 标签的结构体交给驱动绑定
+	named := sql.Named("id", 1)
+	query, args, err = newPlaceholders(OracleDialect{}).bind("SELECT * FROM XSQL WHERE ID = :id", []interface{}{named}, false)
+	a.Empty(err)
+	a.Equal("SELECT * FROM XSQL WHERE ID = :id", query)
+	a.Equal([]interface{}{named}, args)
+
+	type untagged struct{ Id int }
+	query, args, err = newPlaceholders(OracleDialect{}).bind("SELECT * FROM XSQL WHERE ID = :id", []interface{}{untagged{Id: 1}}, false)
+	a.Empty(err)
+	a.Equal("SELECT * FROM XSQL WHERE ID = :id", query)
+	a.Equal([]interface{}{untagged{Id: 1}}, args)
+
+	DB, rec := newFakeDB(Oracle())
+	_, err = DB.Query("SELECT * FROM XSQL WHERE ID = :id", sql.Named("id", 1))
+	a.Empty(err)
+	a.Equal("SELECT * FROM XSQL WHERE ID = :id", rec.Last().SQL)
+	a.Equal([]interface{}{1}, rec.Last().Args)
+}
+
+func TestSliceArgs(t *testing.T) {
+	a := assert.New(t)
+
+	query, args, err := newPlaceholders(MysqlDialect{}).bind("SELECT * FROM xsql WHERE id IN (?) AND foo = ?",
+		[]interface{}{[]int{1, 2, 3}, "v"}, false)
+	a.Empty(err)
+	a.Equal("SELECT * FROM xsql WHERE id IN (?, ?, ?) AND foo = ?", query)
+	a.Equal([]interface{}{1, 2, 3, "v"}, args)
+
+	query, args, err = newPlaceholders(OracleDialect{}).bind("SELECT * FROM XSQL WHERE FOO = :2 AND ID IN (:1)",
+		[]interface{}{[]int64{1, 2}, "v"}, false)
+	a.Empty(err)
+	a.Equal("SELECT * FROM XSQL WHERE FOO = :1 AND ID IN (:2, :3)", query)
+	a.Equal([]interface{}{"v", int64(1), int64(2)}, args)
+
+	query, args, err = newPlaceholders(MssqlDialect{}).bind("SELECT * FROM xsql WHERE id IN (?) AND foo = ?",
+		[]interface{}{[]string{"a", "b"}, []byte("v")}, true)
+	a.Empty(err)
+	a.Equal("SELECT * FROM xsql WHERE id IN (@p1, @p2) AND foo = @p3", query)
+	a.Equal([]interface{}{"a", "b", []byte("v")}, args)
+
+	query, args, err = newPlaceholders(PostgresDialect{}).bind("SELECT * FROM xsql WHERE id IN (:ids)",
+		[]interface{}{map[string]interface{}{"ids": []int{1, 2}}}, false)
+	a.Empty(err)
+	a.Equal("SELECT * FROM xsql WHERE id IN ($1, $2)", query)
+	a.Equal([]interface{}{1, 2}, args)
+
+	_, _, err = newPlaceholders(MysqlDialect{}).bind("SELECT * FROM xsql WHERE id IN (?)", []interface{}{[]int{}}, false)
+	a.EqualError(err, "sql: empty slice for placeholder ?")
+
+	// 不在 IN 条件中的切片不展开，如 oracle 的数组绑定
+	ids, names := []int{1, 2, 3}, []string{"a", "b", "c"}
+	query, args, err = newPlaceholders(OracleDialect{}).bind("INSERT INTO T (A, B) VALUES (:1, :2)",
+		[]interface{}{ids, names}, false)
+	a.Empty(err)
+	a.Equal("INSERT INTO T (A, B) VALUES (:1, :2)", query)
+	a.Equal([]interface{}{ids, names}, args)
+
+	query, args, err = newPlaceholders(MysqlDialect{}).bind("SELECT * FROM xsql WHERE id IN (?) AND foo = ?",
+		[]interface{}{[]int{1, 2}, []string{"a"}}, false)
+	a.Empty(err)
+	a.Equal("SELECT * FROM xsql WHERE id IN (?, ?) AND foo = ?", query)
+	a.Equal([]interface{}{1, 2, []string{"a"}}, args)
+}
+
+func TestSliceArgsOracleLimit(t *testing.T) {
+	a := assert.New(t)
+
+	ids := make([]int, 2500)
+	for i := range ids {
+		ids[i] = i
+	}
+
+	query, args, err := newPlaceholders(OracleDialect{}).bind(`SELECT * FROM XSQL WHERE X."ID" IN (:1) AND FOO = :2`,
+		[]interface{}{ids, "v"}, false)
+	a.Empty(err)
+	a.Len(args, 2501)
+	a.Equal("v", args[2500])
+	a.Contains(query, `SELECT * FROM XSQL WHERE (X."ID" IN (:1, :2, `)
+	a.Contains(query, `:1000) OR X."ID" IN (:1001, `)
+	a.Contains(query, `:2000) OR X."ID" IN (:2001, `)
+	a.Contains(query, `:2500)) AND FOO = :2501`)
+
+	query, _, err = newPlaceholders(OracleDialect{}).bind(`SELECT * FROM XSQL WHERE ID NOT IN ( :1 )`,
+		[]interface{}{ids[:1001]}, false)
+	a.Empty(err)
+	a.Contains(query, `SELECT * FROM XSQL WHERE (ID NOT IN (:1, `)
+	a.Contains(query, `:1000) AND ID NOT IN (:1001))`)
+}
@@ -1,6 +1,8 @@
 package xsql
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"reflect"
 	"strings"
@@ -11,9 +13,9 @@ type query struct {
 	Query
 }
 
-func (t *query) Fetch(query string, args []interface{}, opts *Options) (*Fetcher, error) {
+func (t *query) Fetch(ctx context.Context, query string, args []interface{}, opts *Options) (*Fetcher, error) {
 	startTime := time.Now()
-	r, err := t.Query.Query(query, args...)
+	r, err := t.queryContext(ctx, query, args, opts)
 	l := &Log{
 		Time:         time.Now().Sub(startTime),
 		SQL:          query,
@@ -36,6 +38,20 @@ func (t *query) Fetch(query string, args []interface{}, opts *Options) (*Fetcher
 	return f, err
 }
 
+// queryContext 执行查询，不在事务中时按 opts.Retry 重试临时错误，返回的错误按方言分类
+func (t *query) queryContext(ctx context.Context, query string, args []interface{}, opts *Options) (*sql.Rows, error) {
+	if _, ok := t.Query.(*sql.Tx); ok {
+		rows, err := t.Query.QueryContext(ctx, query, args...)
+		return rows, opts.wrapError(err)
+	}
+	var rows *sql.Rows
+	err := opts.retry(ctx, Log{SQL: query, Bindings: args}, func() (err error) {
+		rows, err = t.Query.QueryContext(ctx, query, args...)
+		return err
+	})
+	return rows, opts.wrapError(err)
+}
+
 // WhereObj
 // @Description: where条件语句组装器
 type WhereObj struct {
@@ -0,0 +1,163 @@
+package xsql
+
+import (
+	"context"
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/sijms/go-ora/v2/network"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// RetryPolicy 死锁、锁等待超时等临时错误的重试策略
+// 事务外的语句失败后重新执行该语句，DB.Transaction 中发生的错误重新执行整个事务
+// 已开启的事务 (Tx) 中的语句不会单独重试，死锁时数据库已回滚整个事务
+type RetryPolicy struct {
+	// 最多执行次数，包含首次执行，小于 2 时不重试
+	MaxAttempts int
+
+	// 首次重试前的等待时间，之后每次翻倍，默认: 50ms
+	MinBackoff time.Duration
+
+	// 等待时间上限，默认: 1s
+	MaxBackoff time.Duration
+
+	// 随机抖动比例 0~1，等待时间在 [backoff*(1-Jitter), backoff] 之间随机，避免冲突的事务同时重试
+	Jitter float64
+
+	// 判断错误是否可重试，默认使用方言的 Retryable
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy 默认重试策略：最多执行 3 次，等待 50ms、100ms，抖动 20%
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 3,
+		MinBackoff:  50 * time.Millisecond,
+		MaxBackoff:  time.Second,
+		Jitter:      0.2,
+	}
+}
+
+// backoff 第 n 次重试前的等待时间，n 从 1 开始
+func (t *RetryPolicy) backoff(n int) time.Duration {
+	d := t.MinBackoff
+	if d <= 0 {
+		d = 50 * time.Millisecond
+	}
+	max := t.MaxBackoff
+	if max <= 0 {
+		max = time.Second
+	}
+	for i := 1; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if t.Jitter > 0 {
+		jitter := t.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		d -= time.Duration(rand.Float64() * jitter * float64(d))
+	}
+	return d
+}
+
+/*
+@Description: 按重试策略执行 fn，遇到可重试的错误时等待后重新执行，每次重试通过 DebugFunc 输出日志
+@receiver t
+@param ctx 取消时停止重试，返回最后一次的错误
+@param l 重试日志模板，填充 SQL、Bindings
+@param fn
+@return error
+*/
+func (t *Options) retry(ctx context.Context, l Log, fn func() error) error {
+	policy := t.Retry
+	if policy == nil || policy.MaxAttempts < 2 {
+		return fn()
+	}
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = t.dialect().Retryable
+	}
+
+	for n := 1; ; n++ {
+		startTime := time.Now()
+		err := fn()
+		if err == nil || n >= policy.MaxAttempts || !retryable(err) {
+			return err
+		}
+
+		if t.DebugFunc != nil {
+			retryLog := l
+			retryLog.Time = time.Now().Sub(startTime)
+			retryLog.Error = err
+			retryLog.Retry = n
+			t.DebugFunc(&retryLog)
+		}
+		timer := time.NewTimer(policy.backoff(n))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// Retryable mysql 1213 死锁，1205 锁等待超时
+func (MysqlDialect) Retryable(err error) bool {
+	var e *mysql.MySQLError
+	if errors.As(err, &e) {
+		return e.Number == 1213 || e.Number == 1205
+	}
+	return false
+}
+
+// Retryable oracle ORA-00060 死锁，ORA-08177 可串行化事务冲突
+func (OracleDialect) Retryable(err error) bool {
+	var e *network.OracleError
+	if errors.As(err, &e) {
+		return e.ErrCode == 60 || e.ErrCode == 8177
+	}
+	// 其他驱动的错误信息同样以错误码开头
+	msg := err.Error()
+	return strings.Contains(msg, "ORA-00060") || strings.Contains(msg, "ORA-08177")
+}
+
+// Retryable sql server 1205 死锁，1222 锁请求超时
+func (MssqlDialect) Retryable(err error) bool {
+	var e interface {
+		SQLErrorNumber() int32
+	}
+	if errors.As(err, &e) {
+		return e.SQLErrorNumber() == 1205 || e.SQLErrorNumber() == 1222
+	}
+	return false
+}
+
+// Retryable postgresql 40001 可串行化事务冲突，40P01 死锁
+func (PostgresDialect) Retryable(err error) bool {
+	var e interface {
+		SQLState() string
+	}
+	if errors.As(err, &e) {
+		return e.SQLState() == "40001" || e.SQLState() == "40P01"
+	}
+	return false
+}
+
+// Retryable sqlite SQLITE_BUSY、SQLITE_LOCKED 及其扩展错误码
+func (SqliteDialect) Retryable(err error) bool {
+	var e interface {
+		Code() int
+	}
+	if errors.As(err, &e) {
+		code := e.Code() & 0xff
+		return code == 5 || code == 6
+	}
+	return false
+}
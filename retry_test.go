@@ -0,0 +1,222 @@
+package xsql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/sijms/go-ora/v2/network"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newRetryDB(maxAttempts int) (*DB, *fakeRecorder, *[]*Log) {
+	logs := make([]*Log, 0)
+	DB, rec := newFakeDB(Options{
+		Retry: &RetryPolicy{
+			MaxAttempts: maxAttempts,
+			MinBackoff:  time.Millisecond,
+			MaxBackoff:  2 * time.Millisecond,
+			Jitter:      0.5,
+		},
+		DebugFunc: func(l *Log) {
+			logs = append(logs, l)
+		},
+	})
+	return DB, rec, &logs
+}
+
+// failTimes 前 n 次执行 query 返回 err
+func failTimes(n int, query string, err error) func(string) error {
+	return func(q string) error {
+		if q == query && n > 0 {
+			n--
+			return err
+		}
+		return nil
+	}
+}
+
+func TestRetryExec(t *testing.T) {
+	a := assert.New(t)
+
+	deadlock := &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+	DB, rec, logs := newRetryDB(3)
+	rec.Err = failTimes(2, "DELETE FROM xsql WHERE id = ?", deadlock)
+
+	_, err := DB.Exec("DELETE FROM xsql WHERE id = ?", 1)
+	a.Empty(err)
+	a.Len(rec.Stmts, 3)
+
+	retries := make([]int, 0)
+	for _, l := range *logs {
+		retries = append(retries, l.Retry)
+	}
+	a.Equal([]int{1, 2, 0}, retries)
+	a.Equal(deadlock, (*logs)[0].Error)
+	a.Equal("DELETE FROM xsql WHERE id = ?", (*logs)[0].SQL)
+}
+
+func TestRetryExhausted(t *testing.T) {
+	a := assert.New(t)
+
+	lockTimeout := &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"}
+	DB, rec, _ := newRetryDB(2)
+	rec.Err = failTimes(5, "SELECT * FROM xsql", lockTimeout)
+
+	_, err := DB.Query("SELECT * FROM xsql")
+	a.ErrorIs(err, lockTimeout)
+	a.Len(rec.Stmts, 2)
+
+	// 非临时错误不重试
+	DB, rec, _ = newRetryDB(3)
+	rec.Err = failTimes(5, "SELECT * FROM xsql", &mysql.MySQLError{Number: 1146, Message: "Table doesn't exist"})
+	_, err = DB.Query("SELECT * FROM xsql")
+	a.Error(err)
+	a.Len(rec.Stmts, 1)
+
+	// 未配置重试策略
+	DB, rec = newFakeDB()
+	rec.Err = failTimes(5, "SELECT * FROM xsql", lockTimeout)
+	_, err = DB.Query("SELECT * FROM xsql")
+	a.ErrorIs(err, lockTimeout)
+	a.Len(rec.Stmts, 1)
+}
+
+func TestRetryCanceled(t *testing.T) {
+	a := assert.New(t)
+
+	deadlock := &mysql.MySQLError{Number: 1213}
+	DB, rec, _ := newRetryDB(10)
+	DB.Options.Retry.MinBackoff = time.Hour
+	DB.Options.Retry.MaxBackoff = time.Hour
+	rec.Err = failTimes(5, "DELETE FROM xsql", deadlock)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := DB.ExecContext(ctx, "DELETE FROM xsql")
+	a.ErrorIs(err, deadlock)
+	a.Len(rec.Stmts, 1)
+}
+
+func TestRetryTransaction(t *testing.T) {
+	a := assert.New(t)
+
+	deadlock := &mysql.MySQLError{Number: 1213}
+	DB, rec, logs := newRetryDB(3)
+	rec.Err = failTimes(1, "UPDATE xsql SET foo = ? WHERE id = ?", deadlock)
+
+	runs := 0
+	err := DB.Transaction(context.Background(), func(tx *Tx) error {
+		runs++
+		_, err := tx.Exec("UPDATE xsql SET foo = ? WHERE id = ?", "bar", 1)
+		return err
+	})
+	a.Empty(err)
+	a.Equal(2, runs)
+	// 事务中的语句不单独重试，整个事务重新执行
+	a.Equal([]string{
+		"BEGIN", "UPDATE xsql SET foo = ? WHERE id = ?", "ROLLBACK",
+		"BEGIN", "UPDATE xsql SET foo = ? WHERE id = ?", "COMMIT",
+	}, rec.SQL())
+
+	retried := make([]*Log, 0)
+	for _, l := range *logs {
+		if l.Retry > 0 {
+			retried = append(retried, l)
+		}
+	}
+	a.Len(retried, 1)
+	a.Equal("TRANSACTION", retried[0].SQL)
+	a.ErrorIs(retried[0].Error, deadlock)
+
+	// fn 返回的非临时错误不重试
+	runs = 0
+	errFoo := errors.New("foo")
+	err = DB.Transaction(context.Background(), func(tx *Tx) error {
+		runs++
+		return errFoo
+	})
+	a.ErrorIs(err, errFoo)
+	a.Equal(1, runs)
+}
+
+type sqlStateError string
+
+func (t sqlStateError) Error() string {
+	return "pq: " + string(t)
+}
+
+func (t sqlStateError) SQLState() string {
+	return string(t)
+}
+
+type mssqlError int32
+
+func (t mssqlError) Error() string {
+	return fmt.Sprintf("mssql: %d", int32(t))
+}
+
+func (t mssqlError) SQLErrorNumber() int32 {
+	return int32(t)
+}
+
+type sqliteError int
+
+func (t sqliteError) Error() string {
+	return fmt.Sprintf("sqlite: %d", int(t))
+}
+
+func (t sqliteError) Code() int {
+	return int(t)
+}
+
+func TestDialectRetryable(t *testing.T) {
+	a := assert.New(t)
+
+	cases := []struct {
+		dialect   Dialect
+		err       error
+		retryable bool
+	}{
+		{MysqlDialect{}, &mysql.MySQLError{Number: 1213}, true},
+		{MysqlDialect{}, fmt.Errorf("update: %w", &mysql.MySQLError{Number: 1205}), true},
+		{MysqlDialect{}, &mysql.MySQLError{Number: 1062}, false},
+		{MysqlDialect{}, errors.New("Deadlock"), false},
+		{OracleDialect{}, &network.OracleError{ErrCode: 60, ErrMsg: "ORA-00060: deadlock detected while waiting for resource"}, true},
+		{OracleDialect{}, &network.OracleError{ErrCode: 8177, ErrMsg: "ORA-08177: can't serialize access for this transaction"}, true},
+		{OracleDialect{}, errors.New("ORA-00060: deadlock detected while waiting for resource"), true},
+		{OracleDialect{}, &network.OracleError{ErrCode: 1, ErrMsg: "ORA-00001: unique constraint violated"}, false},
+		{MssqlDialect{}, mssqlError(1205), true},
+		{MssqlDialect{}, mssqlError(2627), false},
+		{PostgresDialect{}, sqlStateError("40P01"), true},
+		{PostgresDialect{}, sqlStateError("40001"), true},
+		{PostgresDialect{}, sqlStateError("23505"), false},
+		{SqliteDialect{}, sqliteError(5), true},
+		{SqliteDialect{}, sqliteError(517), true},
+		{SqliteDialect{}, sqliteError(19), false},
+	}
+	for _, c := range cases {
+		a.Equal(c.retryable, c.dialect.Retryable(c.err), "%s %v", c.dialect.Name(), c.err)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	a := assert.New(t)
+
+	policy := RetryPolicy{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond,
+	}
+	a.Equal(10*time.Millisecond, policy.backoff(1))
+	a.Equal(20*time.Millisecond, policy.backoff(2))
+	a.Equal(40*time.Millisecond, policy.backoff(3))
+	a.Equal(50*time.Millisecond, policy.backoff(4))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := policy.backoff(2)
+		a.True(d > 10*time.Millisecond && d <= 20*time.Millisecond, d)
+	}
+}
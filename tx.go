@@ -1,16 +1,190 @@
 package xsql
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
 
 type Tx struct {
 	raw *sql.Tx
 	*DB
+
+	// 嵌套事务的保存点，最外层事务为空
+	savepoint string
+	depth     int
+	parent    *Tx
+	done      bool
+	// 最外层事务中已创建的保存点数量，用于生成不重复的保存点名称
+	savepoints int
+
+	onCommit   []func()
+	onRollback []func()
+}
+
+// OnCommit 注册事务提交后执行的回调，按注册顺序执行
+// 嵌套事务提交时回调移交给外层事务，直到最外层事务提交后才执行
+func (t *Tx) OnCommit(fn func()) {
+	t.onCommit = append(t.onCommit, fn)
+}
+
+// OnRollback 注册事务回滚后执行的回调，按注册顺序执行
+// 嵌套事务提交后若外层事务回滚，同样会执行
+func (t *Tx) OnRollback(fn func()) {
+	t.onRollback = append(t.onRollback, fn)
 }
 
 func (t *Tx) Commit() error {
-	return t.raw.Commit()
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	if t.parent == nil {
+		if err := t.raw.Commit(); err != nil {
+			t.rolledBack()
+			return t.Options.wrapError(err)
+		}
+		for _, fn := range t.onCommit {
+			fn()
+		}
+		return nil
+	}
+
+	_, _, release := t.Options.dialect().Savepoint(t.savepoint)
+	if release != "" {
+		if _, err := t.executor.Exec(context.Background(), release, nil, &t.Options); err != nil {
+			return err
+		}
+	}
+	t.parent.onCommit = append(t.parent.onCommit, t.onCommit...)
+	t.parent.onRollback = append(t.parent.onRollback, t.onRollback...)
+	return nil
 }
 
 func (t *Tx) Rollback() error {
-	return t.raw.Rollback()
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	var err error
+	if t.parent == nil {
+		err = t.raw.Rollback()
+	} else {
+		_, rollback, _ := t.Options.dialect().Savepoint(t.savepoint)
+		_, err = t.executor.Exec(context.Background(), rollback, nil, &t.Options)
+	}
+	if err != nil {
+		return err
+	}
+	t.rolledBack()
+	return nil
+}
+
+func (t *Tx) rolledBack() {
+	for _, fn := range t.onRollback {
+		fn()
+	}
+}
+
+// Begin 开启嵌套事务
+func (t *Tx) Begin() (*Tx, error) {
+	return t.BeginTx(context.Background(), nil)
+}
+
+/*
+@Description: 开启嵌套事务，使用保存点实现，Rollback 回滚到保存点，Commit 释放保存点
+@receiver t
+@param ctx
+@param opts 嵌套事务沿用外层事务的隔离级别，忽略该参数
+@return *Tx
+@return error
+*/
+func (t *Tx) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	if t.done {
+		return nil, sql.ErrTxDone
+	}
+	root := t
+	for root.parent != nil {
+		root = root.parent
+	}
+	root.savepoints++
+	name := fmt.Sprintf("xsql_sp_%d", root.savepoints)
+	create, _, _ := t.Options.dialect().Savepoint(name)
+	if _, err := t.executor.Exec(ctx, create, nil, &t.Options); err != nil {
+		return nil, err
+	}
+	return &Tx{
+		raw:       t.raw,
+		DB:        t.DB,
+		savepoint: name,
+		depth:     t.depth + 1,
+		parent:    t,
+	}, nil
+}
+
+// Transaction 在嵌套事务中执行 fn，嵌套事务沿用外层事务的隔离级别与只读设置
+func (t *Tx) Transaction(ctx context.Context, fn func(tx *Tx) error) error {
+	return transaction(func() (*Tx, error) {
+		return t.BeginTx(ctx, nil)
+	}, fn)
+}
+
+// RollbackError 回滚失败时同时保留原始错误与回滚错误，errors.Is/As 作用于原始错误
+type RollbackError struct {
+	Err      error
+	Rollback error
+}
+
+func (t *RollbackError) Error() string {
+	return fmt.Sprintf("%v (rollback: %v)", t.Err, t.Rollback)
+}
+
+func (t *RollbackError) Unwrap() error {
+	return t.Err
+}
+
+/*
+@Description: 在事务中执行 fn，返回 nil 时提交，返回错误或 panic 时回滚，panic 会在回滚后继续抛出
+配置了 Options.Retry 时，fn 或提交返回死锁等可重试的错误后，在新的事务中重新执行 fn，fn 需要可以重复执行
+@receiver t
+@param ctx
+@param fn
+@param opts 隔离级别、只读事务，以最后一个为准
+@return error
+*/
+func (t *DB) Transaction(ctx context.Context, fn func(tx *Tx) error, opts ...*sql.TxOptions) error {
+	var txOpts *sql.TxOptions
+	for _, o := range opts {
+		txOpts = o
+	}
+	return t.Options.retry(ctx, Log{SQL: "TRANSACTION"}, func() error {
+		return transaction(func() (*Tx, error) {
+			return t.BeginTx(ctx, txOpts)
+		}, fn)
+	})
+}
+
+func transaction(begin func() (*Tx, error), fn func(tx *Tx) error) error {
+	tx, err := begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return &RollbackError{
+				Err:      err,
+				Rollback: rbErr,
+			}
+		}
+		return err
+	}
+	return tx.Commit()
 }
@@ -0,0 +1,266 @@
+package xsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTransactionCommit(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	err := DB.Transaction(context.Background(), func(tx *Tx) error {
+		_, err := tx.Insert(&TestSqlite{Foo: "test", Bar: time.Now()})
+		return err
+	})
+	a.Empty(err)
+
+	rows, err := DB.Query("SELECT * FROM xsql")
+	a.Empty(err)
+	a.Len(rows, 3)
+}
+
+func TestTransactionRollback(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	errFoo := errors.New("foo")
+	err := DB.Transaction(context.Background(), func(tx *Tx) error {
+		if _, err := tx.Insert(&TestSqlite{Foo: "test", Bar: time.Now()}); err != nil {
+			return err
+		}
+		return errFoo
+	})
+	a.ErrorIs(err, errFoo)
+
+	rows, err := DB.Query("SELECT * FROM xsql")
+	a.Empty(err)
+	a.Len(rows, 2)
+}
+
+func TestTransactionPanic(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	a.PanicsWithValue("foo", func() {
+		_ = DB.Transaction(context.Background(), func(tx *Tx) error {
+			if _, err := tx.Insert(&TestSqlite{Foo: "test", Bar: time.Now()}); err != nil {
+				return err
+			}
+			panic("foo")
+		})
+	})
+
+	rows, err := DB.Query("SELECT * FROM xsql")
+	a.Empty(err)
+	a.Len(rows, 2)
+}
+
+func TestTransactionRollbackError(t *testing.T) {
+	a := assert.New(t)
+
+	DB, rec := newFakeDB()
+	errRollback := errors.New("rollback")
+	rec.Err = func(query string) error {
+		if query == "ROLLBACK" {
+			return errRollback
+		}
+		return nil
+	}
+
+	errFoo := errors.New("foo")
+	err := DB.Transaction(context.Background(), func(tx *Tx) error {
+		return errFoo
+	}, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	a.ErrorIs(err, errFoo)
+
+	var rbErr *RollbackError
+	a.ErrorAs(err, &rbErr)
+	a.Equal(errRollback, rbErr.Rollback)
+	a.Equal("foo (rollback: rollback)", err.Error())
+	a.Equal([]string{"BEGIN", "ROLLBACK"}, rec.SQL())
+}
+
+func TestNestedTx(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	tx, err := DB.Begin()
+	a.Empty(err)
+	_, err = tx.Insert(&TestSqlite{Foo: "outer", Bar: time.Now()})
+	a.Empty(err)
+
+	inner, err := tx.Begin()
+	a.Empty(err)
+	_, err = inner.Insert(&TestSqlite{Foo: "rollback", Bar: time.Now()})
+	a.Empty(err)
+	a.Empty(inner.Rollback())
+	a.ErrorIs(inner.Commit(), sql.ErrTxDone)
+
+	inner, err = tx.Begin()
+	a.Empty(err)
+	_, err = inner.Insert(&TestSqlite{Foo: "commit", Bar: time.Now()})
+	a.Empty(err)
+	a.Empty(inner.Commit())
+
+	a.Empty(tx.Commit())
+
+	var tests []TestSqlite
+	err = DB.Find(&tests, "SELECT * FROM xsql WHERE id > 2")
+	a.Empty(err)
+	a.Len(tests, 2)
+	a.Equal("outer", tests[0].Foo)
+	a.Equal("commit", tests[1].Foo)
+}
+
+func TestNestedTransaction(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	errFoo := errors.New("foo")
+	err := DB.Transaction(context.Background(), func(tx *Tx) error {
+		if _, err := tx.Insert(&TestSqlite{Foo: "outer", Bar: time.Now()}); err != nil {
+			return err
+		}
+		err := tx.Transaction(context.Background(), func(tx *Tx) error {
+			if _, err := tx.Insert(&TestSqlite{Foo: "inner", Bar: time.Now()}); err != nil {
+				return err
+			}
+			return errFoo
+		})
+		a.ErrorIs(err, errFoo)
+		return nil
+	})
+	a.Empty(err)
+
+	rows, err := DB.Query("SELECT * FROM xsql WHERE id > 2")
+	a.Empty(err)
+	a.Len(rows, 1)
+	a.Equal("outer", rows[0].Get("foo").String())
+}
+
+func TestNestedTxDialect(t *testing.T) {
+	a := assert.New(t)
+
+	for _, c := range []struct {
+		opts Options
+		sql  []string
+	}{
+		{Options{}, []string{"BEGIN", "SAVEPOINT xsql_sp_1", "SAVEPOINT xsql_sp_2", "ROLLBACK TO SAVEPOINT xsql_sp_2", "RELEASE SAVEPOINT xsql_sp_1", "COMMIT"}},
+		{Oracle(), []string{"BEGIN", "SAVEPOINT xsql_sp_1", "SAVEPOINT xsql_sp_2", "ROLLBACK TO SAVEPOINT xsql_sp_2", "COMMIT"}},
+		{Mssql(), []string{"BEGIN", "SAVE TRANSACTION xsql_sp_1", "SAVE TRANSACTION xsql_sp_2", "ROLLBACK TRANSACTION xsql_sp_2", "COMMIT"}},
+	} {
+		DB, rec := newFakeDB(c.opts)
+
+		tx, err := DB.Begin()
+		a.Empty(err)
+		inner, err := tx.Begin()
+		a.Empty(err)
+		innermost, err := inner.Begin()
+		a.Empty(err)
+		a.Empty(innermost.Rollback())
+		a.Empty(inner.Commit())
+		a.Empty(tx.Commit())
+
+		a.Equal(c.sql, rec.SQL())
+	}
+
+	// 同一层级的嵌套事务使用不同的保存点
+	DB, rec := newFakeDB()
+	tx, err := DB.Begin()
+	a.Empty(err)
+	first, err := tx.Begin()
+	a.Empty(err)
+	a.Empty(first.Commit())
+	second, err := tx.Begin()
+	a.Empty(err)
+	inner, err := second.Begin()
+	a.Empty(err)
+	a.Empty(inner.Commit())
+	a.Empty(second.Rollback())
+	a.Empty(tx.Commit())
+	a.Equal([]string{
+		"BEGIN",
+		"SAVEPOINT xsql_sp_1",
+		"RELEASE SAVEPOINT xsql_sp_1",
+		"SAVEPOINT xsql_sp_2",
+		"SAVEPOINT xsql_sp_3",
+		"RELEASE SAVEPOINT xsql_sp_3",
+		"ROLLBACK TO SAVEPOINT xsql_sp_2",
+		"COMMIT",
+	}, rec.SQL())
+}
+
+func TestTxHooks(t *testing.T) {
+	a := assert.New(t)
+
+	DB := newSqliteDB()
+
+	events := make([]string, 0)
+	hook := func(event string) func() {
+		return func() {
+			events = append(events, event)
+		}
+	}
+
+	tx, err := DB.Begin()
+	a.Empty(err)
+	tx.OnCommit(hook("commit 1"))
+	tx.OnRollback(hook("rollback 1"))
+
+	inner, err := tx.Begin()
+	a.Empty(err)
+	inner.OnCommit(hook("inner commit"))
+	inner.OnRollback(hook("inner rollback"))
+	a.Empty(inner.Commit())
+	// 嵌套事务提交时不执行
+	a.Empty(events)
+
+	rolledBack, err := tx.Begin()
+	a.Empty(err)
+	rolledBack.OnCommit(hook("discarded commit"))
+	rolledBack.OnRollback(hook("savepoint rollback"))
+	a.Empty(rolledBack.Rollback())
+	a.Equal([]string{"savepoint rollback"}, events)
+
+	tx.OnCommit(hook("commit 2"))
+	a.Empty(tx.Commit())
+	a.Equal([]string{"savepoint rollback", "commit 1", "inner commit", "commit 2"}, events)
+
+	events = events[:0]
+	err = DB.Transaction(context.Background(), func(tx *Tx) error {
+		tx.OnCommit(hook("commit"))
+		tx.OnRollback(hook("rollback"))
+		return tx.Transaction(context.Background(), func(tx *Tx) error {
+			tx.OnRollback(hook("inner rollback"))
+			return nil
+		})
+	})
+	a.Empty(err)
+	a.Equal([]string{"commit"}, events)
+
+	events = events[:0]
+	errFoo := errors.New("foo")
+	err = DB.Transaction(context.Background(), func(tx *Tx) error {
+		tx.OnCommit(hook("commit"))
+		tx.OnRollback(hook("rollback"))
+		if err := tx.Transaction(context.Background(), func(tx *Tx) error {
+			tx.OnRollback(hook("inner rollback"))
+			return nil
+		}); err != nil {
+			return err
+		}
+		return errFoo
+	})
+	a.ErrorIs(err, errFoo)
+	a.Equal([]string{"rollback", "inner rollback"}, events)
+}